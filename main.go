@@ -1,20 +1,41 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	gocsv "encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
 	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	awsathena "github.com/aws/aws-sdk-go-v2/service/athena"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/quortex/influxdb-athena-crawler/pkg/athena"
+	"github.com/quortex/influxdb-athena-crawler/pkg/awsauth"
+	"github.com/quortex/influxdb-athena-crawler/pkg/compress"
 	"github.com/quortex/influxdb-athena-crawler/pkg/csv"
+	"github.com/quortex/influxdb-athena-crawler/pkg/events"
 	"github.com/quortex/influxdb-athena-crawler/pkg/flags"
 	"github.com/quortex/influxdb-athena-crawler/pkg/influxdb"
+	"github.com/quortex/influxdb-athena-crawler/pkg/jsonl"
+	"github.com/quortex/influxdb-athena-crawler/pkg/parquet"
+	"github.com/quortex/influxdb-athena-crawler/pkg/prefix"
+	"github.com/quortex/influxdb-athena-crawler/pkg/quarantine"
+	"github.com/quortex/influxdb-athena-crawler/pkg/state"
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sync/errgroup"
@@ -22,9 +43,10 @@ import (
 
 var opts flags.Options
 
-func main() {
-	start := time.Now()
+// version is the crawler version, set at build time
+var version = "dev"
 
+func main() {
 	// Parse flags
 	if err := flags.Parse(&opts); err != nil {
 		log.Fatal().Err(err).Msg("Failed to parse flags")
@@ -35,84 +57,121 @@ func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	zerolog.DurationFieldUnit = time.Second
 
-	// Initialize context with defined timeout
+	influxWriter := influxdb.NewWriters(
+		opts.InfluxServers,
+		opts.InfluxToken,
+		opts.InfluxOrg,
+		opts.InfluxBucket,
+		opts.Measurement,
+		opts.TimestampLayout,
+		opts.TimestampRow,
+		opts.Tags,
+		opts.NullTokens,
+		opts.SourceTag,
+	)
+	defer influxWriter.Close()
+
+	switch {
+	case opts.SQSQueueURL != "":
+		consumeEvents(influxWriter)
+	case opts.AthenaQuery != "" || opts.AthenaNamedQueryID != "":
+		runQuery(influxWriter)
+	default:
+		crawl(influxWriter)
+	}
+}
+
+// timeoutContext returns a context with the global timeout, exiting the
+// program once reached
+func timeoutContext() (context.Context, context.CancelFunc) {
 	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
-	defer cancel()
 	go func() {
 		<-ctx.Done()
-		log.Fatal().Msg("Timeout reached !")
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Fatal().Msg("Timeout reached !")
+		}
 	}()
+	return ctx, cancel
+}
 
-	// Init AWS s3 client
-	// Using the SDK's default configuration, loading additional config
-	// and credentials values from the environment variables, shared
-	// credentials, and shared configuration files
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(opts.Region))
+// crawl lists the whole prefix, processes objects that have yet to be
+// processed and cleans up processed ones
+func crawl(influxWriter influxdb.Writers) {
+	start := time.Now()
+
+	// Initialize context with defined timeout
+	ctx, cancel := timeoutContext()
+	defer cancel()
+
+	// Init object store
+	objStore, err := newObjectStore(ctx)
 	if err != nil {
 		log.Fatal().
 			Err(err).
-			Msg("unable to load SDK config")
+			Msg("unable to initialize object store")
 	}
-	s3Cli := s3.NewFromConfig(cfg)
 
-	p := s3.NewListObjectsV2Paginator(s3Cli, &s3.ListObjectsV2Input{
-		Bucket: aws.String(opts.Bucket),
-		Prefix: aws.String(opts.Prefix),
-	})
+	// Init state store
+	st, err := newStateStore(ctx, objStore, storeName())
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("unable to initialize state store")
+	}
+	defer st.Close()
 
-	for p.HasMorePages() {
-		elems, err := p.NextPage(ctx)
-		if err != nil {
-			log.Fatal().Err(err).Msg("Unable to get object page")
-		}
+	// Init archive store, validating it before any processing
+	archive, err := newArchiveStore(ctx, objStore)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("unable to initialize archive store")
+	}
 
-		unprocCsvs, procCsvs, orphanFlags := filterBucketContent(*elems, opts.Suffix, opts.ProcessedFlagSuffix)
+	prefixes, err := expandPrefixes(time.Now())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid prefix template")
+	}
 
-		if len(procCsvs.Contents)+len(unprocCsvs.Contents)+len(orphanFlags.Contents) == 0 {
-			log.Info().Msg("No objects matching bucket / prefix, processing done !")
-			return
-		}
+	elems, err := listObjects(ctx, objStore, prefixes)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to list objects")
+	}
 
-		dwn := manager.NewDownloader(s3Cli)
-		upl := manager.NewUploader(s3Cli)
-		influxWriter := influxdb.NewWriters(
-			opts.InfluxServers,
-			opts.InfluxToken,
-			opts.InfluxOrg,
-			opts.InfluxBucket,
-			opts.Measurement,
-			opts.TimestampLayout,
-			opts.TimestampRow,
-			opts.Tags,
-			opts.Fields,
-		)
-		defer influxWriter.Close()
-
-		if len(unprocCsvs.Contents) > 0 {
-			err = parallelApply(ctx, unprocCsvs, func(o types.Object) error {
-				return processObject(ctx, dwn, upl, influxWriter, o)
-			})
-			if err != nil {
-				log.Fatal().Err(err).Msg("Failed processing objects")
-			}
+	unprocCsvs, procCsvs, orphanFlags, err := filterBucketContent(ctx, elems, opts.Suffix, opts.ProcessedFlagSuffix, matchFilters, st)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to get objects processing state")
+	}
+
+	if len(procCsvs)+len(unprocCsvs)+len(orphanFlags) == 0 {
+		log.Info().Msg("No objects matching bucket / prefix, processing done !")
+		return
+	}
+
+	if len(unprocCsvs) > 0 {
+		err = parallelApply(ctx, unprocCsvs, func(o store.Object) error {
+			return processOrQuarantine(ctx, objStore, st, influxWriter, o)
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed processing objects")
 		}
+	}
 
-		if opts.CleanObjects && len(procCsvs.Contents) > 0 {
-			err = parallelApply(ctx, procCsvs, func(o types.Object) error {
-				return cleanObject(ctx, s3Cli, o)
-			})
-			if err != nil {
-				log.Fatal().Err(err).Msg("Failed cleaning objects")
-			}
+	if opts.CleanObjects && len(procCsvs) > 0 {
+		err = parallelApply(ctx, procCsvs, func(o store.Object) error {
+			return cleanObject(ctx, objStore, archive, st, o)
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed cleaning objects")
 		}
+	}
 
-		if len(orphanFlags.Contents) > 0 {
-			err = parallelApply(ctx, orphanFlags, func(o types.Object) error {
-				return cleanObject(ctx, s3Cli, o)
-			})
-			if err != nil {
-				log.Fatal().Err(err).Msg("Failed cleaning orphan flags")
-			}
+	if len(orphanFlags) > 0 {
+		err = parallelApply(ctx, orphanFlags, func(o store.Object) error {
+			return cleanOrphan(ctx, objStore, o)
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed cleaning orphan flags")
 		}
 	}
 
@@ -121,55 +180,501 @@ func main() {
 		Msg("Processing ended !")
 }
 
-// Rely on .processed files present on the bucket to detect which csv
-// has already been pushed to influx and which has yet to be processed
-// List .processed files that do not match any data file in order to clean them up, this can happen if the crawler was interrupted
-func filterBucketContent(elems s3.ListObjectsV2Output, csvSuffix, processedFlagSuffix string) (unprocessed, processed, orphanFlags s3.ListObjectsOutput) {
-	csvFiles := []types.Object{}
-	flags := []types.Object{}
-	objectNames := []string{}
-	flagNames := []string{}
+// runQuery runs the configured Athena query, waits for it to finish and
+// processes its result object
+func runQuery(influxWriter influxdb.Writers) {
+	start := time.Now()
 
-	if len(csvSuffix) == 0 {
-		return unprocessed, processed, orphanFlags
+	// Initialize context with defined timeout
+	ctx, cancel := timeoutContext()
+	defer cancel()
+
+	cfg, err := loadAWSConfig(ctx, sourceRole())
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("unable to load SDK config")
+	}
+
+	runner := athena.NewRunner(awsathena.NewFromConfig(cfg), opts.AthenaPollInterval)
+	id, location, err := runner.Run(ctx, athena.Query{
+		SQL:            opts.AthenaQuery,
+		NamedQueryID:   opts.AthenaNamedQueryID,
+		Database:       opts.AthenaDatabase,
+		WorkGroup:      opts.AthenaWorkGroup,
+		OutputLocation: opts.AthenaOutputLocation,
+	})
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Str("query execution id", id).
+			Msg("Athena query failed")
 	}
-	for _, s := range elems.Contents {
-		if strings.HasSuffix(*s.Key, csvSuffix) {
-			csvFiles = append(csvFiles, s)
-			objectNames = append(objectNames, *s.Key)
+	log.Info().
+		Str("query execution id", id).
+		Str("location", location).
+		Msg("Athena query succeeded")
+
+	bucket, key, err := store.ParseS3URI(location)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Str("query execution id", id).
+			Msg("Invalid query output location")
+	}
+	cli, err := store.NewS3Client(cfg, s3Options())
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("unable to initialize S3 client")
+	}
+	objStore := store.NewS3WithDownloader(cli, bucket, newDownloader())
+
+	st, err := newStateStore(ctx, objStore, bucket)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("unable to initialize state store")
+	}
+	defer st.Close()
+
+	o, ok, err := store.Find(ctx, objStore, key)
+	if err != nil || !ok {
+		log.Fatal().
+			Err(err).
+			Str("query execution id", id).
+			Str("bucket", bucket).
+			Str("object", key).
+			Msg("Unable to find query output object")
+	}
+	if err = processOrQuarantine(ctx, objStore, st, influxWriter, o); err != nil {
+		log.Fatal().
+			Err(err).
+			Str("query execution id", id).
+			Msg("Failed processing query output object")
+	}
+
+	log.Info().
+		Dur("elapsed", time.Since(start)).
+		Msg("Processing ended !")
+}
+
+// consumeEvents runs until interrupted, processing objects notified by
+// S3 event notifications received from an SQS queue
+func consumeEvents(influxWriter influxdb.Writers) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Check prefix templates once for all
+	if _, err := expandPrefixes(time.Now()); err != nil {
+		log.Fatal().Err(err).Msg("Invalid prefix template")
+	}
+
+	// Init object store
+	objStore, err := newObjectStore(ctx)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("unable to initialize object store")
+	}
+
+	// Init state store
+	st, err := newStateStore(ctx, objStore, storeName())
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("unable to initialize state store")
+	}
+	defer st.Close()
+
+	cfg, err := loadAWSConfig(ctx, sourceRole())
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("unable to load SDK config")
+	}
+	sqsCli := sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		if opts.SQSEndpointURL != "" {
+			o.BaseEndpoint = aws.String(opts.SQSEndpointURL)
 		}
-		if strings.HasSuffix(*s.Key, processedFlagSuffix) {
-			flags = append(flags, s)
-			flagNames = append(flagNames, *s.Key)
+	})
+	consumer := events.NewConsumer(
+		sqsCli,
+		opts.SQSQueueURL,
+		opts.Bucket,
+		opts.SQSWaitTime,
+		opts.SQSVisibilityTimeout,
+	)
+
+	log.Info().
+		Str("queue", opts.SQSQueueURL).
+		Msg("Consuming S3 event notifications")
+
+	for ctx.Err() == nil {
+		err := consumer.Consume(ctx, func(ctx context.Context, o store.Object) error {
+			// Each object is processed within the global timeout
+			ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+			return handleEvent(ctx, objStore, st, influxWriter, o)
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Error().
+				Err(err).
+				Str("queue", opts.SQSQueueURL).
+				Msg("Failed to receive messages")
+			time.Sleep(time.Second)
 		}
 	}
 
-	for _, o := range csvFiles {
-		flagName := strings.ReplaceAll(*o.Key, csvSuffix, processedFlagSuffix)
-		if !slices.Contains(flagNames, flagName) {
-			unprocessed.Contents = append(unprocessed.Contents, o)
-		} else {
-			processed.Contents = append(processed.Contents, o)
+	log.Info().Msg("Interrupted, stopped consuming S3 event notifications")
+}
+
+// handleEvent processes an object notified by an S3 event notification,
+// unless it does not match the prefix / suffix or is already processed
+func handleEvent(
+	ctx context.Context,
+	objStore store.ObjectStore,
+	st state.Store,
+	influxWriter influxdb.Writers,
+	o store.Object,
+) error {
+	if !hasPrefix(o.Key) || isArchived(o.Key) || isQuarantined(o.Key) || !isDataKey(o.Key, opts.Suffix, opts.ProcessedFlagSuffix) || !matchFilters(o.Key) {
+		return nil
+	}
+
+	// Notifications may be delivered more than once
+	processed, err := st.Processed(ctx, o)
+	if err != nil {
+		return err
+	}
+	if processed {
+		log.Info().
+			Str("object", o.Key).
+			Msg("Object already processed, skipping")
+		return nil
+	}
+
+	return processOrQuarantine(ctx, objStore, st, influxWriter, o)
+}
+
+// loadAWSConfig loads the AWS SDK configuration, assuming given role if any
+func loadAWSConfig(ctx context.Context, role awsauth.Role) (aws.Config, error) {
+	// Using the SDK's default configuration, loading additional config
+	// and credentials values from the environment variables, shared
+	// credentials, and shared configuration files
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(opts.Region))
+	if err != nil {
+		return aws.Config{}, err
+	}
+	return awsauth.AssumeRole(cfg, sts.NewFromConfig(cfg), role), nil
+}
+
+// sourceRole returns the role to access the crawled bucket and the
+// Athena / SQS APIs with according to flags
+func sourceRole() awsauth.Role {
+	return awsauth.Role{
+		ARN:         opts.RoleARN,
+		ExternalID:  opts.RoleExternalID,
+		SessionName: opts.RoleSessionName,
+	}
+}
+
+// stateRole returns the role to access the DynamoDB state store and the
+// archive bucket with according to flags, the source one if not set
+func stateRole() awsauth.Role {
+	if opts.StateRoleARN == "" {
+		return sourceRole()
+	}
+	return awsauth.Role{
+		ARN:         opts.StateRoleARN,
+		ExternalID:  opts.StateRoleExternalID,
+		SessionName: opts.RoleSessionName,
+	}
+}
+
+// s3Clients holds the S3 clients of each role, created at startup
+var s3Clients = map[awsauth.Role]*s3.Client{}
+
+// newS3Client returns an S3 client according to flags, with the
+// credentials of given role. Stores using the same role share their
+// client, so that objects are copied server side between them.
+func newS3Client(ctx context.Context, role awsauth.Role) (*s3.Client, error) {
+	if cli, ok := s3Clients[role]; ok {
+		return cli, nil
+	}
+	cfg, err := loadAWSConfig(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+	cli, err := store.NewS3Client(cfg, s3Options())
+	if err != nil {
+		return nil, err
+	}
+	s3Clients[role] = cli
+	return cli, nil
+}
+
+// s3Options returns the S3 client options according to flags
+func s3Options() store.S3Options {
+	return store.S3Options{
+		EndpointURL:   opts.S3EndpointURL,
+		UsePathStyle:  opts.S3ForcePathStyle,
+		DisableSSL:    opts.S3DisableSSL,
+		RequesterPays: opts.S3RequesterPays,
+		CABundle:      opts.S3CABundle,
+	}
+}
+
+// newDownloader returns the S3 objects Downloader according to flags,
+// its budget is shared by all objects of the store using it
+func newDownloader() *store.Downloader {
+	return store.NewDownloader(store.DownloadOptions{
+		PartSize:       int64(opts.DownloadPartSize),
+		Concurrency:    opts.DownloadConcurrency,
+		MaxConnections: opts.DownloadMaxConnections,
+		MaxBandwidth:   int64(opts.DownloadMaxBandwidth),
+	})
+}
+
+// storeName returns the name of the crawled object store, the local
+// directory or the bucket
+func storeName() string {
+	if opts.LocalDir != "" {
+		return opts.LocalDir
+	}
+	return opts.Bucket
+}
+
+// newObjectStore returns the ObjectStore to crawl according to flags
+func newObjectStore(ctx context.Context) (store.ObjectStore, error) {
+	if opts.LocalDir != "" {
+		return store.NewLocal(opts.LocalDir), nil
+	}
+
+	// Init AWS s3 client
+	cli, err := newS3Client(ctx, sourceRole())
+	if err != nil {
+		return nil, err
+	}
+	return store.NewS3WithDownloader(cli, opts.Bucket, newDownloader()), nil
+}
+
+// archiving returns whether objects are archived before being cleaned
+func archiving() bool {
+	return opts.ArchivePrefix != "" || opts.ArchiveBucket != ""
+}
+
+// archiveInStore returns whether objects are archived in the crawled store
+func archiveInStore() bool {
+	return archiving() && (opts.LocalDir != "" || opts.ArchiveBucket == "" || opts.ArchiveBucket == opts.Bucket)
+}
+
+// isArchived returns whether given key is the one of an archived object
+// of the crawled store, which must not be processed again
+func isArchived(key string) bool {
+	return archiveInStore() && strings.HasPrefix(key, opts.ArchivePrefix)
+}
+
+// isQuarantined returns whether given key is the one of a quarantined
+// object (or its error sidecar), which must not be processed again
+func isQuarantined(key string) bool {
+	return opts.QuarantinePrefix != "" && strings.HasPrefix(key, opts.QuarantinePrefix)
+}
+
+// newArchiveStore returns the ObjectStore to archive objects to according
+// to flags, nil if objects are not archived.
+// The archive bucket and storage class are checked so that
+// misconfigurations are detected before processing anything.
+func newArchiveStore(ctx context.Context, objStore store.ObjectStore) (store.ObjectStore, error) {
+	if !archiving() {
+		return nil, nil
+	}
+	if opts.ArchiveStorageClass != "" {
+		storageClass := s3types.StorageClass(opts.ArchiveStorageClass)
+		if !slices.Contains(storageClass.Values(), storageClass) {
+			return nil, fmt.Errorf("invalid archive storage class %q, valid ones are %v", storageClass, storageClass.Values())
 		}
 	}
+	if archiveInStore() {
+		return objStore, nil
+	}
+
+	cli, err := newS3Client(ctx, stateRole())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := cli.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(opts.ArchiveBucket)}); err != nil {
+		return nil, fmt.Errorf("archive bucket %q is not accessible: %w", opts.ArchiveBucket, err)
+	}
+	return store.NewS3(cli, opts.ArchiveBucket), nil
+}
 
-	for _, f := range flags {
-		fileName := strings.ReplaceAll(*f.Key, processedFlagSuffix, csvSuffix)
-		if !slices.Contains(objectNames, fileName) {
-			orphanFlags.Contents = append(orphanFlags.Contents, f)
+// newStateStore returns the processing state Store according to flags
+// for given object store, bucket being its name
+func newStateStore(ctx context.Context, objStore store.ObjectStore, bucket string) (state.Store, error) {
+	switch opts.StateStore {
+	case flags.StateStoreTagging:
+		cli, err := newS3Client(ctx, sourceRole())
+		if err != nil {
+			return nil, err
 		}
+		return state.NewTagging(cli, bucket), nil
+	case flags.StateStoreFile:
+		return state.NewFile(opts.StateFile, bucket)
+	case flags.StateStoreDynamoDB:
+		cfg, err := loadAWSConfig(ctx, stateRole())
+		if err != nil {
+			return nil, err
+		}
+		cli := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+			if opts.StateDynamoDBEndpointURL != "" {
+				o.BaseEndpoint = aws.String(opts.StateDynamoDBEndpointURL)
+			}
+		})
+		return state.NewDynamoDB(cli, opts.StateDynamoDBTable, bucket), nil
+	default:
+		return state.NewMarkers(objStore, opts.Suffix, opts.ProcessedFlagSuffix), nil
+	}
+}
 
+// expandPrefixes returns prefixes from flags, templates being expanded
+// over the lookback window ending at given time
+func expandPrefixes(now time.Time) ([]string, error) {
+	if len(opts.Prefixes) == 0 {
+		return []string{""}, nil
 	}
+	return prefix.Expand(opts.Prefixes, now, opts.PrefixLookback, opts.PrefixStep)
+}
 
-	return unprocessed, processed, orphanFlags
+// listObjects lists objects of given prefixes, objects matching several
+// prefixes being returned once and archived or quarantined objects being
+// skipped
+func listObjects(ctx context.Context, objStore store.ObjectStore, prefixes []string) ([]store.Object, error) {
+	res := []store.Object{}
+	seen := map[string]struct{}{}
+	for _, p := range prefixes {
+		objs, err := objStore.List(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range objs {
+			if _, ok := seen[o.Key]; ok || isArchived(o.Key) || isQuarantined(o.Key) {
+				continue
+			}
+			seen[o.Key] = struct{}{}
+			res = append(res, o)
+		}
+	}
+	return res, nil
 }
 
-func parallelApply(ctx context.Context, list s3.ListObjectsOutput, fn func(o types.Object) error) error {
+// hasPrefix returns whether given key matches one of the prefixes.
+// Keys of notified objects may belong to any partition, whatever the
+// lookback window, they are matched against the static part of prefix
+// templates.
+func hasPrefix(key string) bool {
+	if len(opts.Prefixes) == 0 {
+		return true
+	}
+	for _, p := range prefix.Static(opts.Prefixes) {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFilters returns whether given key matches include / exclude
+// patterns: it must match one of the includes (if any) and none of the
+// excludes
+func matchFilters(key string) bool {
+	for _, p := range opts.Excludes {
+		if p.Match(key) {
+			return false
+		}
+	}
+	if len(opts.Includes) == 0 {
+		return true
+	}
+	for _, p := range opts.Includes {
+		if p.Match(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterBucketContent splits listed objects into data objects that have
+// yet to be processed, processed ones and orphan processed flags to clean
+// up, relying on given state store to detect which objects have already
+// been pushed to influx.
+// Data objects not matching the filter are not returned.
+func filterBucketContent(
+	ctx context.Context,
+	elems []store.Object,
+	csvSuffix, processedFlagSuffix string,
+	filter func(key string) bool,
+	st state.Store,
+) (unprocessed, processed, orphanFlags []store.Object, err error) {
+	if err = st.Load(ctx, elems); err != nil {
+		return nil, nil, nil, err
+	}
+
+	data := []store.Object{}
+	for _, o := range elems {
+		if isDataKey(o.Key, csvSuffix, processedFlagSuffix) && filter(o.Key) {
+			data = append(data, o)
+		}
+	}
+
+	// Stores may look states up remotely, do it in parallel
+	states := make([]bool, len(data))
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(opts.MaxRoutines)
+	for i := range data {
+		i := i
+		g.Go(func() error {
+			ok, err := st.Processed(gCtx, data[i])
+			states[i] = ok
+			return err
+		})
+	}
+	if err = g.Wait(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	for i, o := range data {
+		if states[i] {
+			processed = append(processed, o)
+		} else {
+			unprocessed = append(unprocessed, o)
+		}
+	}
+
+	orphanFlags, err = st.Orphans(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return unprocessed, processed, orphanFlags, nil
+}
+
+// isDataKey returns whether given key is a data file one, that is a key
+// matching the suffix (any key if empty) which is neither a flag nor an
+// Athena metadata file
+func isDataKey(key, csvSuffix, processedFlagSuffix string) bool {
+	if state.IsMarkerKey(key, processedFlagSuffix) || strings.HasSuffix(key, athena.MetadataSuffix) {
+		return false
+	}
+	_, ok := state.KeyStem(key, csvSuffix)
+	return ok
+}
+
+func parallelApply(ctx context.Context, list []store.Object, fn func(o store.Object) error) error {
 	//Limit the number of parallel routines doing the processing.
 	g, _ := errgroup.WithContext(ctx)
 	g.SetLimit(opts.MaxRoutines)
 
-	for _, item := range list.Contents {
+	for _, item := range list {
 		o := item
 		g.Go(func() error {
 			return fn(o)
@@ -180,107 +685,520 @@ func parallelApply(ctx context.Context, list s3.ListObjectsOutput, fn func(o typ
 
 func processObject(
 	ctx context.Context,
-	s3Dwn *manager.Downloader,
-	s3Upl *manager.Uploader,
-	influxWriter influxdb.Writer,
-	o types.Object,
+	objStore store.ObjectStore,
+	st state.Store,
+	influxWriter influxdb.Writers,
+	o store.Object,
 ) error {
 	log.Info().
-		Str("object", aws.ToString(o.Key)).
-		Time("last modified", aws.ToTime(o.LastModified)).
-		Int64("size", *o.Size).
-		Msg("Processing s3 object")
-
-	// Download object
-	buf := manager.NewWriteAtBuffer([]byte{})
-	_, err := s3Dwn.Download(ctx, buf, &s3.GetObjectInput{
-		Bucket: aws.String(opts.Bucket),
-		Key:    o.Key,
-	})
+		Str("object", o.Key).
+		Time("last modified", o.LastModified).
+		Int64("size", o.Size).
+		Msg("Processing object")
+
+	// The previous record and the fields are read before opening the
+	// object, so that no other download is waited for while holding one
+	prev, err := st.Record(ctx, o)
 	if err != nil {
 		log.Error().
 			Err(err).
-			Str("bucket", opts.Bucket).
-			Str("object", aws.ToString(o.Key)).
+			Str("object", o.Key).
+			Msg("Failed to get previous processing record")
+		return err
+	}
+	fields := objectFields(ctx, objStore, o.Key)
+
+	// Get object content as a stream
+	body, err := objStore.Get(ctx, o.Key)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("object", o.Key).
 			Msg("Failed to download object")
 		return err
 	}
+	defer body.Close()
+
+	// Decompress content on the fly if needed
+	codec := compress.Detect(o.Key, body.ContentEncoding)
+	r, err := compress.NewReader(body, codec)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("object", o.Key).
+			Str("codec", string(codec)).
+			Msg("Failed to decompress object")
+		return contentError(err)
+	}
+	defer r.Close()
+
+	// Servers already having the current version of a partially
+	// processed object are not written to again, while objects overwritten
+	// since their processing are written again to all servers, previous
+	// points may need to be deleted first
+	writer := influxWriter
+	var written []string
+	if prev != nil && prev.Partial && state.Current(prev, o) {
+		written = prev.InfluxServers
+		writer = influxWriter.Only(excludeServers(influxWriter.Servers(), written)...)
+		log.Info().
+			Str("object", o.Key).
+			Strs("servers", writer.Servers()).
+			Msg("Object partially processed, writing to missing servers only")
+	} else if prev != nil && opts.DeleteBeforeRewrite {
+		if err = deletePrevious(ctx, influxWriter, o, prev); err != nil {
+			return err
+		}
+	}
+
+	// Parse rows one at a time and write them to InfluxDB by batches,
+	// so that memory usage depends on batch size rather than object size
+	batch := make([]map[string]interface{}, 0, opts.BatchSize)
+	lines := make([]int, 0, opts.BatchSize)
+	var rows int64
+	var stats influxdb.Stats
+	// Objects found invalid once previous batches are written are
+	// already partially written to InfluxDB
+	invalid := func(qErr *quarantine.Error) error {
+		if stats.Points > 0 {
+			log.Warn().
+				Str("object", o.Key).
+				Int64("written points", stats.Points).
+				Msg("Invalid object already partially written to InfluxDB")
+		}
+		qErr.WrittenPoints = stats.Points
+		return qErr
+	}
+	flush := func() error {
+		s, err := writer.WriteRecords(ctx, o.Key, batch, fields)
+		var sErr *influxdb.ServersError
+		if errors.As(err, &sErr) && len(sErr.Errors) < len(writer.Servers()) {
+			// Keep writing to healthy servers, failed ones will be
+			// written to on next processing
+			log.Error().
+				Err(err).
+				Str("object", o.Key).
+				Msg("Failed to write records to some servers")
+			writer = writer.Only(excludeServers(writer.Servers(), sErr.Servers())...)
+			err = nil
+		}
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("object", o.Key).
+				Msg("Failed to write records")
 
-	// Parse CSV to a map[string]interface{} slice
-	res, err := csv.ParseString(string(buf.Bytes()))
+			// Rows which cannot be converted make the object invalid
+			var rErr *influxdb.RowError
+			if errors.As(err, &rErr) {
+				return invalid(&quarantine.Error{
+					Err:   err,
+					Line:  lines[rErr.Row],
+					Row:   rows - int64(len(batch)) + int64(rErr.Row) + 1,
+					Field: rErr.Column,
+				})
+			}
+			return err
+		}
+		stats.Add(s)
+		batch = batch[:0]
+		lines = lines[:0]
+		return nil
+	}
+	var errWrite error
+	skipped, err := parseObject(ctx, o.Key, r, func(row map[string]interface{}, line int) error {
+		rows++
+		batch = append(batch, row)
+		lines = append(lines, line)
+		if len(batch) < opts.BatchSize {
+			return nil
+		}
+		errWrite = flush()
+		return errWrite
+	})
 	if err != nil {
+		if errWrite == nil {
+			log.Error().
+				Err(err).
+				Str("object", o.Key).
+				Msg("Failed to parse object")
+			err = contentError(fmt.Errorf("object %s: %w", o.Key, err))
+			var qErr *quarantine.Error
+			if errors.As(err, &qErr) {
+				return invalid(qErr)
+			}
+		}
+		return err
+	}
+	if len(batch) > 0 {
+		if err = flush(); err != nil {
+			return err
+		}
+	}
+
+	if skipped > 0 {
+		log.Warn().
+			Str("object", o.Key).
+			Int("skipped rows", skipped).
+			Msg("Skipped ragged rows")
+	}
+
+	// Mark object as processed to avoid writing the same file to influx twice.
+	rec := &state.Record{
+		ETag:           o.ETag,
+		LastModified:   o.LastModified,
+		Size:           o.Size,
+		Rows:           rows,
+		Points:         stats.Points,
+		RejectedRows:   rows - stats.Points,
+		SkippedRows:    int64(skipped),
+		InfluxServers:  append(append([]string{}, written...), writer.Servers()...),
+		Measurement:    opts.Measurement,
+		CrawlerVersion: version,
+		ProcessedAt:    time.Now().UTC(),
+	}
+	if stats.Points > 0 {
+		rec.MinTimestamp = &stats.MinTime
+		rec.MaxTimestamp = &stats.MaxTime
+	}
+	rec.Partial = len(rec.InfluxServers) < len(influxWriter.Servers())
+	if err = st.MarkProcessed(ctx, o, rec); err != nil {
 		log.Error().
 			Err(err).
-			Str("object", aws.ToString(o.Key)).
-			Msg("Failed to parse CSV")
+			Str("object", o.Key).
+			Msg("Failed to mark object as processed")
+		return err
+	}
+	if rec.Partial {
+		return fmt.Errorf(
+			"object %s written to %d of %d InfluxDB servers",
+			o.Key, len(rec.InfluxServers), len(influxWriter.Servers()),
+		)
+	}
+	return nil
+}
+
+// contentError returns given error as a *quarantine.Error, located if
+// possible, if it describes an invalid object content (parsing,
+// decompression...). Other errors, such as failures to read the object,
+// are returned as is so that the object is processed again.
+func contentError(err error) error {
+	var rErr *store.ReadError
+	if errors.As(err, &rErr) {
 		return err
 	}
 
-	// Write records to InfluxDB
-	if err = influxWriter.WriteRecords(ctx, res); err != nil {
+	qErr := &quarantine.Error{Err: err}
+	var pErr *gocsv.ParseError
+	var fcErr *csv.FieldCountError
+	var dErr *csv.DuplicateColumnError
+	var cErr *compress.FormatError
+	var pqErr *parquet.FormatError
+	var sErr *json.SyntaxError
+	var tErr *json.UnmarshalTypeError
+	var jErr *jsonl.Error
+	switch {
+	case errors.As(err, &pErr):
+		qErr.Line = pErr.Line
+		qErr.Column = pErr.Column
+	case errors.As(err, &fcErr):
+		qErr.Line = fcErr.Line
+		qErr.Field = fcErr.Column
+	case errors.As(err, &dErr):
+		qErr.Line = dErr.Line
+		qErr.Field = dErr.Column
+	case errors.As(err, &sErr), errors.As(err, &tErr),
+		// Truncated JSON content, read failures being excluded above
+		errors.Is(err, io.ErrUnexpectedEOF):
+		if errors.As(err, &jErr) {
+			qErr.Line = jErr.Line
+		}
+	case errors.As(err, &cErr), errors.As(err, &pqErr):
+	default:
+		return err
+	}
+	return qErr
+}
+
+// processOrQuarantine processes given object, moving it to the
+// quarantine prefix if its content is invalid so that it is not retried
+func processOrQuarantine(
+	ctx context.Context,
+	objStore store.ObjectStore,
+	st state.Store,
+	influxWriter influxdb.Writers,
+	o store.Object,
+) error {
+	err := processObject(ctx, objStore, st, influxWriter, o)
+	var qErr *quarantine.Error
+	if opts.QuarantinePrefix == "" || !errors.As(err, &qErr) {
+		return err
+	}
+
+	qKey, err := quarantine.Move(ctx, objStore, o, opts.QuarantinePrefix, err)
+	if err != nil {
 		log.Error().
 			Err(err).
-			Str("object", aws.ToString(o.Key)).
-			Msg("Failed to write records")
+			Str("object", o.Key).
+			Msg("Failed to quarantine object")
 		return err
 	}
+	// A partial state may have been recorded by a previous run
+	if err = st.Delete(ctx, o.Key); err != nil {
+		log.Error().
+			Err(err).
+			Str("object", o.Key).
+			Msg("Unable to delete object processing state")
+		return err
+	}
+	log.Warn().
+		Err(qErr).
+		Str("object", o.Key).
+		Str("quarantine", qKey).
+		Msg("Invalid object quarantined")
+	return nil
+}
 
-	// Add .processed file to S3 bucket to avoid writing the same file to influx twice.
-	markerFileName := strings.ReplaceAll(*o.Key, opts.Suffix, opts.ProcessedFlagSuffix)
-	if _, err = s3Upl.Upload(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(opts.Bucket),
-		Key:    &markerFileName,
-		Body:   bytes.NewReader([]byte{0}),
-	}); err != nil {
+// excludeServers returns given servers but excluded ones
+func excludeServers(servers, excluded []string) []string {
+	res := []string{}
+	for _, server := range servers {
+		if !slices.Contains(excluded, server) {
+			res = append(res, server)
+		}
+	}
+	return res
+}
+
+// deletePrevious deletes points written from the previous version of
+// given object, described by given record
+func deletePrevious(
+	ctx context.Context,
+	influxWriter influxdb.Writers,
+	o store.Object,
+	prev *state.Record,
+) error {
+	if prev.MinTimestamp == nil || prev.MaxTimestamp == nil {
+		return nil
+	}
+
+	log.Info().
+		Str("object", o.Key).
+		Str("previous etag", prev.ETag).
+		Time("min timestamp", *prev.MinTimestamp).
+		Time("max timestamp", *prev.MaxTimestamp).
+		Msg("Object changed since processed, deleting previous points")
+	if err := influxWriter.Delete(ctx, o.Key, *prev.MinTimestamp, *prev.MaxTimestamp); err != nil {
 		log.Error().
 			Err(err).
-			Str("object", aws.ToString(o.Key)).
-			Msg("Failed to create .processed file")
+			Str("object", o.Key).
+			Msg("Failed to delete previous points")
 		return err
 	}
 	return nil
 }
 
+// objectFields returns the fields to write for the object with given key.
+// When fields inference is enabled, they are inferred from the Athena
+// .metadata file of the object, falling back to flags fields.
+func objectFields(ctx context.Context, objStore store.ObjectStore, key string) []*flags.Field {
+	if !opts.InferFields {
+		return opts.Fields
+	}
+
+	metadataKey := compress.TrimExt(key) + athena.MetadataSuffix
+	r, err := objStore.Get(ctx, metadataKey)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("object", key).
+			Str("metadata", metadataKey).
+			Msg("Failed to get metadata, fields will not be inferred")
+		return opts.Fields
+	}
+	defer r.Close()
+
+	cols, err := athena.ParseMetadata(r)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("object", key).
+			Str("metadata", metadataKey).
+			Msg("Failed to parse metadata, fields will not be inferred")
+		return opts.Fields
+	}
+
+	if objectFormat(key) == flags.FormatCSV {
+		if cols, err = csvColumns(cols); err != nil {
+			log.Warn().
+				Err(err).
+				Str("object", key).
+				Str("metadata", metadataKey).
+				Msg("Failed to name metadata columns, fields will not be inferred")
+			return opts.Fields
+		}
+	}
+	return athena.InferFields(cols, opts.TimestampRow, opts.Tags, opts.Fields)
+}
+
+// csvColumns returns given metadata columns named as CSV rows are keyed,
+// i.e. normalized and deduplicated as header fields. Ignored columns are
+// removed.
+func csvColumns(cols []athena.Column) ([]athena.Column, error) {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.Name
+	}
+	names, err := csvDialect().HeaderNames(names)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]athena.Column, 0, len(cols))
+	for i, c := range cols {
+		if names[i] != "" {
+			c.Name = names[i]
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+// objectFormat returns the format of the object with given key,
+// detecting it from the key unless forced by flags
+func objectFormat(key string) flags.Format {
+	if opts.Format != flags.FormatAuto {
+		return opts.Format
+	}
+	switch path.Ext(strings.ToLower(compress.TrimExt(key))) {
+	case ".parquet":
+		return flags.FormatParquet
+	case ".json", ".jsonl", ".ndjson":
+		return flags.FormatJSONL
+	}
+	return flags.FormatCSV
+}
+
+// csvDialect returns the dialect of CSV objects according to flags
+func csvDialect() csv.Dialect {
+	return csv.Dialect{
+		Delimiter:         rune(opts.CSVDelimiter),
+		LazyQuotes:        opts.CSVLazyQuotes,
+		Comment:           rune(opts.CSVComment),
+		SkipLeadingLines:  opts.CSVSkipLeadingLines,
+		SkipTrailingLines: opts.CSVSkipTrailingLines,
+		Columns:           opts.CSVColumns,
+		RowShape:          csv.RowShape(opts.CSVRaggedRows),
+		HeaderCase:        csv.HeaderCase(opts.CSVHeaderCase),
+		DuplicateColumns:  csv.DuplicateColumns(opts.CSVDuplicateColumns),
+	}
+}
+
+// parseObject reads rows from the content of the object with given key
+// according to its format and calls fn for each of them along with the
+// line it starts on (0 if unknown), CSV parsing stopping once given
+// context is done.
+// It returns how many ragged CSV rows were skipped.
+func parseObject(ctx context.Context, key string, r io.Reader, fn func(row map[string]interface{}, line int) error) (int, error) {
+	switch objectFormat(key) {
+	case flags.FormatParquet:
+		return 0, parquet.ParseReader(r, func(row map[string]interface{}) error {
+			return fn(row, 0)
+		})
+	case flags.FormatJSONL:
+		reader := jsonl.NewReader(r)
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				return 0, nil
+			} else if err != nil {
+				return 0, err
+			}
+			if err := fn(row, reader.Line()); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	reader := csv.NewReader(r, csvDialect())
+	for {
+		row, err := reader.Read(ctx)
+		if err == io.EOF {
+			return reader.SkippedRows(), nil
+		} else if err != nil {
+			return reader.SkippedRows(), err
+		}
+		if err := fn(row, reader.Line()); err != nil {
+			return reader.SkippedRows(), err
+		}
+	}
+}
+
+// cleanObject deletes given processed data object along with its
+// processing state once old enough, archiving it first to given archive
+// store if not nil
 func cleanObject(
 	ctx context.Context,
-	s3Cli *s3.Client,
-	o types.Object,
+	objStore, archive store.ObjectStore,
+	st state.Store,
+	o store.Object,
 ) error {
-	if time.Since(aws.ToTime(o.LastModified)) > opts.MaxObjectAge {
+	if time.Since(o.LastModified) > opts.MaxObjectAge {
 		// Delete object
 		log.Info().
-			Str("object", aws.ToString(o.Key)).
-			Time("last modified", aws.ToTime(o.LastModified)).
-			Int64("size", *o.Size).
-			Msg("Cleaning s3 object")
-
-		_, err := s3Cli.DeleteObject(ctx, &s3.DeleteObjectInput{
-			Bucket: aws.String(opts.Bucket),
-			Key:    o.Key,
-		})
-		if err != nil {
+			Str("object", o.Key).
+			Time("last modified", o.LastModified).
+			Int64("size", o.Size).
+			Msg("Cleaning object")
+
+		if archive != nil {
+			archiveKey := opts.ArchivePrefix + o.Key
+			if err := store.Copy(ctx, objStore, o, archive, archiveKey, opts.ArchiveStorageClass); err != nil {
+				log.Error().
+					Err(err).
+					Str("object", o.Key).
+					Str("archive", archiveKey).
+					Msg("Unable to archive object")
+				return err
+			}
+		}
+
+		if err := objStore.Delete(ctx, o.Key); err != nil {
 			log.Error().
 				Err(err).
-				Str("bucket", opts.Bucket).
-				Str("object", aws.ToString(o.Key)).
+				Str("object", o.Key).
 				Msg("Unable to delete object")
 			return err
 		}
 
-		if !strings.Contains(*o.Key, opts.ProcessedFlagSuffix) {
-			markerFileName := strings.ReplaceAll(*o.Key, opts.Suffix, opts.ProcessedFlagSuffix)
-			_, err = s3Cli.DeleteObject(ctx, &s3.DeleteObjectInput{
-				Bucket: aws.String(opts.Bucket),
-				Key:    &markerFileName,
-			})
-			if err != nil {
-				log.Error().
-					Err(err).
-					Str("bucket", opts.Bucket).
-					Str("object", aws.ToString(o.Key)).
-					Msg("Unable to delete object")
-				return err
-			}
+		if err := st.Delete(ctx, o.Key); err != nil {
+			log.Error().
+				Err(err).
+				Str("object", o.Key).
+				Msg("Unable to delete object processing state")
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanOrphan deletes given orphan processed flag once old enough
+func cleanOrphan(
+	ctx context.Context,
+	objStore store.ObjectStore,
+	o store.Object,
+) error {
+	if time.Since(o.LastModified) > opts.MaxObjectAge {
+		log.Info().
+			Str("object", o.Key).
+			Time("last modified", o.LastModified).
+			Msg("Cleaning orphan flag")
+
+		if err := objStore.Delete(ctx, o.Key); err != nil {
+			log.Error().
+				Err(err).
+				Str("object", o.Key).
+				Msg("Unable to delete object")
+			return err
 		}
 	}
 	return nil
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quortex/influxdb-athena-crawler/pkg/athena"
+	"github.com/quortex/influxdb-athena-crawler/pkg/flags"
+	"github.com/quortex/influxdb-athena-crawler/pkg/influxdb"
+	"github.com/quortex/influxdb-athena-crawler/pkg/quarantine"
+	"github.com/quortex/influxdb-athena-crawler/pkg/state"
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+	"github.com/rs/zerolog"
+)
+
+func TestMain(m *testing.M) {
+	// Processing logs are noise in tests output
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+func Test_csvColumns(t *testing.T) {
+	tests := []struct {
+		name             string
+		headerCase       string
+		duplicateColumns string
+		cols             []athena.Column
+		want             []athena.Column
+		wantErr          bool
+	}{
+		{
+			name: "Duplicate columns should be suffixed",
+			cols: []athena.Column{
+				{Name: "timestamp", Type: "timestamp"},
+				{Name: "audience", Type: "bigint"},
+				{Name: "audience", Type: "double"},
+			},
+			want: []athena.Column{
+				{Name: "timestamp", Type: "timestamp"},
+				{Name: "audience", Type: "bigint"},
+				{Name: "audience_2", Type: "double"},
+			},
+		},
+		{
+			name:             "Columns should be cased and duplicates ignored",
+			headerCase:       "snake",
+			duplicateColumns: "first",
+			cols: []athena.Column{
+				{Name: "Timestamp", Type: "timestamp"},
+				{Name: "audienceCount", Type: "bigint"},
+				{Name: "audience_count", Type: "double"},
+			},
+			want: []athena.Column{
+				{Name: "timestamp", Type: "timestamp"},
+				{Name: "audience_count", Type: "bigint"},
+			},
+		},
+		{
+			name:             "Duplicate columns should return an error",
+			duplicateColumns: "fail",
+			cols: []athena.Column{
+				{Name: "audience", Type: "bigint"},
+				{Name: "audience", Type: "bigint"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts = flags.Options{
+				CSVHeaderCase:       tt.headerCase,
+				CSVDuplicateColumns: tt.duplicateColumns,
+			}
+			got, err := csvColumns(tt.cols)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("csvColumns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("csvColumns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testTime is the timestamp of the points written by fakeWriters
+var testTime = time.Date(2021, 6, 24, 6, 0, 0, 0, time.UTC)
+
+// fakeWriters is an influxdb.Writers counting the rows written to and the
+// deletions of each server, writes to failing servers returning an error
+type fakeWriters struct {
+	servers []string
+	failing map[string]bool
+	written map[string]int
+	deleted map[string]int
+}
+
+// newFakeWriters returns fakeWriters for given servers
+func newFakeWriters(servers ...string) *fakeWriters {
+	return &fakeWriters{
+		servers: servers,
+		failing: map[string]bool{},
+		written: map[string]int{},
+		deleted: map[string]int{},
+	}
+}
+
+func (w *fakeWriters) WriteRecords(_ context.Context, _ string, rows []map[string]interface{}, _ []*flags.Field) (influxdb.Stats, error) {
+	sErr := &influxdb.ServersError{Errors: map[string]error{}}
+	for _, server := range w.servers {
+		if w.failing[server] {
+			sErr.Errors[server] = errors.New("connection refused")
+			continue
+		}
+		w.written[server] += len(rows)
+	}
+	stats := influxdb.Stats{Points: int64(len(rows)), MinTime: testTime, MaxTime: testTime}
+	if len(sErr.Errors) > 0 {
+		return stats, sErr
+	}
+	return stats, nil
+}
+
+func (w *fakeWriters) Delete(_ context.Context, _ string, _, _ time.Time) error {
+	for _, server := range w.servers {
+		w.deleted[server]++
+	}
+	return nil
+}
+
+func (w *fakeWriters) Close() {}
+
+func (w *fakeWriters) Servers() []string {
+	return w.servers
+}
+
+func (w *fakeWriters) Only(servers ...string) influxdb.Writers {
+	res := *w
+	res.servers = servers
+	return &res
+}
+
+// failingStore is an ObjectStore whose writes fail
+type failingStore struct {
+	store.ObjectStore
+}
+
+func (s failingStore) Put(context.Context, string, io.Reader) error {
+	return errors.New("access denied")
+}
+
+// testOptions returns the options the flow tests start from
+func testOptions() flags.Options {
+	return flags.Options{
+		Suffix:              ".csv",
+		ProcessedFlagSuffix: ".processed",
+		Format:              flags.FormatAuto,
+		MaxRoutines:         2,
+		BatchSize:           1,
+		Measurement:         "foo",
+	}
+}
+
+// writeObject writes an object with given key and content under given
+// root directory, modified at given time
+func writeObject(t *testing.T, root, key, content string, modTime time.Time) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// exists returns whether the object with given key exists under given
+// root directory
+func exists(root, key string) bool {
+	_, err := os.Stat(filepath.Join(root, filepath.FromSlash(key)))
+	return err == nil
+}
+
+// keys returns given objects keys, nil if there are none
+func keys(objects []store.Object) []string {
+	var res []string
+	for _, o := range objects {
+		res = append(res, o.Key)
+	}
+	return res
+}
+
+const (
+	validCSV   = "timestamp,audience\n2021-06-24T06:00:00.000Z,1\n2021-06-24T06:05:00.000Z,2\n"
+	invalidCSV = "timestamp,audience\n2021-06-24T06:00:00.000Z\n"
+)
+
+func Test_filterBucketContent(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name            string
+		objects         map[string]time.Time
+		reverse         bool
+		filter          func(key string) bool
+		wantUnprocessed []string
+		wantProcessed   []string
+		wantOrphans     []string
+	}{
+		{
+			name:          "Data object listed before its marker should be processed",
+			objects:       map[string]time.Time{"foo/a.csv": now, "foo/a.processed": now},
+			wantProcessed: []string{"foo/a.csv"},
+		},
+		{
+			name:          "Data object listed after its marker should be processed",
+			objects:       map[string]time.Time{"foo/a.csv": now, "foo/a.processed": now},
+			reverse:       true,
+			wantProcessed: []string{"foo/a.csv"},
+		},
+		{
+			name:            "Data object without marker should be unprocessed",
+			objects:         map[string]time.Time{"foo/a.csv": now, "foo/a.csv.metadata": now},
+			wantUnprocessed: []string{"foo/a.csv"},
+		},
+		{
+			name:            "Data object modified after its marker should be unprocessed",
+			objects:         map[string]time.Time{"foo/a.csv": now, "foo/a.processed": now.Add(-time.Hour)},
+			wantUnprocessed: []string{"foo/a.csv"},
+		},
+		{
+			name:            "Data object with a partial marker should be unprocessed",
+			objects:         map[string]time.Time{"foo/a.csv": now, "foo/a.processed.partial": now},
+			reverse:         true,
+			wantUnprocessed: []string{"foo/a.csv"},
+		},
+		{
+			name: "Markers without data object should be orphans",
+			objects: map[string]time.Time{
+				"foo/a.csv":               now,
+				"foo/a.processed":         now,
+				"foo/b.processed":         now,
+				"foo/c.processed.partial": now,
+			},
+			wantProcessed: []string{"foo/a.csv"},
+			wantOrphans:   []string{"foo/b.processed", "foo/c.processed.partial"},
+		},
+		{
+			name:            "Data objects not matching the filter should be ignored",
+			objects:         map[string]time.Time{"foo/a.csv": now, "bar/b.csv": now, "bar/b.processed": now},
+			filter:          func(key string) bool { return strings.HasPrefix(key, "foo/") },
+			wantUnprocessed: []string{"foo/a.csv"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts = testOptions()
+			ctx := context.Background()
+			root := t.TempDir()
+			for key, modTime := range tt.objects {
+				// Markers record a previous version of their data object
+				writeObject(t, root, key, `{"last_modified":"2021-06-24T06:00:00Z"}`, modTime)
+			}
+			objStore := store.NewLocal(root)
+			elems, err := objStore.List(ctx, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.reverse {
+				slices.Reverse(elems)
+			}
+			filter := tt.filter
+			if filter == nil {
+				filter = matchFilters
+			}
+
+			st := state.NewMarkers(objStore, opts.Suffix, opts.ProcessedFlagSuffix)
+			unprocessed, processed, orphans, err := filterBucketContent(ctx, elems, opts.Suffix, opts.ProcessedFlagSuffix, filter, st)
+			if err != nil {
+				t.Fatalf("filterBucketContent() error = %v", err)
+			}
+			for _, res := range []struct {
+				name      string
+				got, want []string
+			}{
+				{"unprocessed", keys(unprocessed), tt.wantUnprocessed},
+				{"processed", keys(processed), tt.wantProcessed},
+				{"orphans", keys(orphans), tt.wantOrphans},
+			} {
+				slices.Sort(res.got)
+				if !reflect.DeepEqual(res.got, res.want) {
+					t.Errorf("filterBucketContent() %s = %v, want %v", res.name, res.got, res.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_processObject(t *testing.T) {
+	type run struct {
+		// overwrite overwrites the object before the run
+		overwrite   bool
+		failing     []string
+		wantErr     bool
+		wantWritten map[string]int
+		wantDeleted map[string]int
+		// wantServers are the recorded servers, none if no record is
+		// expected
+		wantServers []string
+		wantPartial bool
+	}
+	tests := []struct {
+		name                string
+		deleteBeforeRewrite bool
+		runs                []run
+	}{
+		{
+			name: "Object should be written to all servers",
+			runs: []run{
+				{wantWritten: map[string]int{"a": 2, "b": 2}, wantServers: []string{"a", "b"}},
+			},
+		},
+		{
+			name: "Partially written object should be retried on missing servers only",
+			runs: []run{
+				{failing: []string{"b"}, wantErr: true, wantWritten: map[string]int{"a": 2}, wantServers: []string{"a"}, wantPartial: true},
+				{wantWritten: map[string]int{"b": 2}, wantServers: []string{"a", "b"}},
+			},
+		},
+		{
+			name: "Object failing on all servers should not be recorded",
+			runs: []run{
+				{failing: []string{"a", "b"}, wantErr: true, wantWritten: map[string]int{}},
+				{wantWritten: map[string]int{"a": 2, "b": 2}, wantServers: []string{"a", "b"}},
+			},
+		},
+		{
+			name: "Partially written object overwritten since should be written to all servers",
+			runs: []run{
+				{failing: []string{"b"}, wantErr: true, wantWritten: map[string]int{"a": 2}, wantServers: []string{"a"}, wantPartial: true},
+				{overwrite: true, wantWritten: map[string]int{"a": 2, "b": 2}, wantServers: []string{"a", "b"}},
+			},
+		},
+		{
+			name:                "Object overwritten since processed should have its previous points deleted",
+			deleteBeforeRewrite: true,
+			runs: []run{
+				{wantWritten: map[string]int{"a": 2, "b": 2}, wantServers: []string{"a", "b"}},
+				{overwrite: true, wantWritten: map[string]int{"a": 2, "b": 2}, wantDeleted: map[string]int{"a": 1, "b": 1}, wantServers: []string{"a", "b"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts = testOptions()
+			opts.DeleteBeforeRewrite = tt.deleteBeforeRewrite
+			ctx := context.Background()
+			root := t.TempDir()
+			modTime := time.Now().Add(-time.Hour)
+			writeObject(t, root, "foo/a.csv", validCSV, modTime)
+			objStore := store.NewLocal(root)
+			st := state.NewMarkers(objStore, opts.Suffix, opts.ProcessedFlagSuffix)
+
+			for i, r := range tt.runs {
+				if r.overwrite {
+					modTime = time.Now().Add(time.Minute)
+					writeObject(t, root, "foo/a.csv", validCSV, modTime)
+				}
+				w := newFakeWriters("a", "b")
+				for _, server := range r.failing {
+					w.failing[server] = true
+				}
+
+				elems, err := objStore.List(ctx, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				unprocessed, _, _, err := filterBucketContent(ctx, elems, opts.Suffix, opts.ProcessedFlagSuffix, matchFilters, st)
+				if err != nil {
+					t.Fatalf("run %d: filterBucketContent() error = %v", i, err)
+				}
+				if len(unprocessed) != 1 {
+					t.Fatalf("run %d: unprocessed objects = %v, want [foo/a.csv]", i, keys(unprocessed))
+				}
+				o := unprocessed[0]
+
+				if err := processObject(ctx, objStore, st, w, o); (err != nil) != r.wantErr {
+					t.Errorf("run %d: processObject() error = %v, wantErr %v", i, err, r.wantErr)
+				}
+				if !reflect.DeepEqual(w.written, r.wantWritten) {
+					t.Errorf("run %d: written rows = %v, want %v", i, w.written, r.wantWritten)
+				}
+				if len(w.deleted) > 0 || len(r.wantDeleted) > 0 {
+					if !reflect.DeepEqual(w.deleted, r.wantDeleted) {
+						t.Errorf("run %d: deletions = %v, want %v", i, w.deleted, r.wantDeleted)
+					}
+				}
+
+				// The store listing is loaded before processing, the
+				// record is read from a new one
+				rec, err := state.NewMarkers(objStore, opts.Suffix, opts.ProcessedFlagSuffix).Record(ctx, o)
+				if err != nil {
+					t.Fatalf("run %d: Record() error = %v", i, err)
+				}
+				if r.wantServers == nil {
+					if rec != nil {
+						t.Errorf("run %d: Record() = %+v, want nil", i, rec)
+					}
+					continue
+				}
+				if rec == nil || !reflect.DeepEqual(rec.InfluxServers, r.wantServers) || rec.Partial != r.wantPartial {
+					t.Errorf("run %d: Record() = %+v, want servers %v and partial %v", i, rec, r.wantServers, r.wantPartial)
+				}
+			}
+		})
+	}
+}
+
+func Test_processOrQuarantine(t *testing.T) {
+	tests := []struct {
+		name             string
+		content          string
+		quarantinePrefix string
+		failing          []string
+		wantErr          bool
+		wantQuarantined  bool
+		wantMarker       bool
+	}{
+		{
+			name:             "Invalid object should be quarantined and its state deleted",
+			content:          invalidCSV,
+			quarantinePrefix: "quarantine/",
+			wantQuarantined:  true,
+		},
+		{
+			name:       "Invalid object should fail without quarantine prefix",
+			content:    invalidCSV,
+			wantErr:    true,
+			wantMarker: true,
+		},
+		{
+			name:             "Object failing to be written should not be quarantined",
+			content:          validCSV,
+			quarantinePrefix: "quarantine/",
+			failing:          []string{"a", "b"},
+			wantErr:          true,
+			wantMarker:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts = testOptions()
+			opts.QuarantinePrefix = tt.quarantinePrefix
+			ctx := context.Background()
+			root := t.TempDir()
+			modTime := time.Now().Add(-time.Hour)
+			writeObject(t, root, "foo/a.csv", tt.content, modTime)
+			objStore := store.NewLocal(root)
+			st := state.NewMarkers(objStore, opts.Suffix, opts.ProcessedFlagSuffix)
+			o, ok, err := store.Find(ctx, objStore, "foo/a.csv")
+			if err != nil || !ok {
+				t.Fatalf("Find() = %v, %v", ok, err)
+			}
+
+			// A previous run wrote the object to some servers only
+			if err := st.MarkProcessed(ctx, o, &state.Record{LastModified: o.LastModified, InfluxServers: []string{"a"}, Partial: true}); err != nil {
+				t.Fatal(err)
+			}
+
+			w := newFakeWriters("a", "b")
+			for _, server := range tt.failing {
+				w.failing[server] = true
+			}
+			if err := processOrQuarantine(ctx, objStore, st, w, o); (err != nil) != tt.wantErr {
+				t.Errorf("processOrQuarantine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for key, want := range map[string]bool{
+				"foo/a.csv":            !tt.wantQuarantined,
+				"quarantine/foo/a.csv": tt.wantQuarantined,
+				"quarantine/foo/a.csv" + quarantine.ErrorSuffix: tt.wantQuarantined,
+				"foo/a.processed.partial":                       tt.wantMarker,
+			} {
+				if got := exists(root, key); got != want {
+					t.Errorf("object %s exists = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_cleanObject(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxObjectAge time.Duration
+		archive      func(objStore store.ObjectStore) store.ObjectStore
+		wantErr      bool
+		wantDeleted  bool
+		wantArchived bool
+	}{
+		{
+			name:        "Old object should be deleted",
+			wantDeleted: true,
+		},
+		{
+			name:         "Old object should be archived then deleted",
+			archive:      func(objStore store.ObjectStore) store.ObjectStore { return objStore },
+			wantDeleted:  true,
+			wantArchived: true,
+		},
+		{
+			name:    "Object failing to be archived should not be deleted",
+			archive: func(objStore store.ObjectStore) store.ObjectStore { return failingStore{objStore} },
+			wantErr: true,
+		},
+		{
+			name:         "Recent object should not be cleaned",
+			maxObjectAge: 2 * time.Hour,
+			archive:      func(objStore store.ObjectStore) store.ObjectStore { return objStore },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts = testOptions()
+			opts.MaxObjectAge = tt.maxObjectAge
+			opts.ArchivePrefix = "archive/"
+			ctx := context.Background()
+			root := t.TempDir()
+			modTime := time.Now().Add(-time.Hour)
+			writeObject(t, root, "foo/a.csv", validCSV, modTime)
+			writeObject(t, root, "foo/a.processed", "{}", modTime)
+			objStore := store.NewLocal(root)
+			st := state.NewMarkers(objStore, opts.Suffix, opts.ProcessedFlagSuffix)
+			o, ok, err := store.Find(ctx, objStore, "foo/a.csv")
+			if err != nil || !ok {
+				t.Fatalf("Find() = %v, %v", ok, err)
+			}
+
+			var archive store.ObjectStore
+			if tt.archive != nil {
+				archive = tt.archive(objStore)
+			}
+			if err := cleanObject(ctx, objStore, archive, st, o); (err != nil) != tt.wantErr {
+				t.Errorf("cleanObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for key, want := range map[string]bool{
+				"foo/a.csv":         !tt.wantDeleted,
+				"foo/a.processed":   !tt.wantDeleted,
+				"archive/foo/a.csv": tt.wantArchived,
+			} {
+				if got := exists(root, key); got != want {
+					t.Errorf("object %s exists = %v, want %v", key, got, want)
+				}
+			}
+			if tt.wantArchived {
+				if b, err := os.ReadFile(filepath.Join(root, "archive", "foo", "a.csv")); err != nil || string(b) != validCSV {
+					t.Errorf("archived object = %q, %v, want %q", b, err, validCSV)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package athena
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsathena "github.com/aws/aws-sdk-go-v2/service/athena"
+	"github.com/aws/aws-sdk-go-v2/service/athena/types"
+)
+
+// Client is the subset of the Athena API used to run queries,
+// it is implemented by *athena.Client
+type Client interface {
+	StartQueryExecution(ctx context.Context, params *awsathena.StartQueryExecutionInput, optFns ...func(*awsathena.Options)) (*awsathena.StartQueryExecutionOutput, error)
+	GetQueryExecution(ctx context.Context, params *awsathena.GetQueryExecutionInput, optFns ...func(*awsathena.Options)) (*awsathena.GetQueryExecutionOutput, error)
+	GetNamedQuery(ctx context.Context, params *awsathena.GetNamedQueryInput, optFns ...func(*awsathena.Options)) (*awsathena.GetNamedQueryOutput, error)
+}
+
+// Query describes an Athena query to run
+type Query struct {
+	// SQL is the statement to run, the NamedQueryID one is used if empty
+	SQL, NamedQueryID string
+	// Database, WorkGroup and OutputLocation are optional, the named
+	// query database and work group being used if not set
+	Database, WorkGroup, OutputLocation string
+}
+
+// QueryError is returned when a query execution did not succeed
+type QueryError struct {
+	ID, State, Reason string
+}
+
+// Error is the error interface implementation for QueryError
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("query execution %s %s: %s", e.ID, e.State, e.Reason)
+}
+
+// Runner describes what an Athena query runner should do
+type Runner interface {
+	// Run starts given query, waits for it to finish and returns its
+	// execution ID and the S3 location of its result.
+	// The execution ID is returned as soon as the query is started,
+	// even if it does not succeed.
+	Run(ctx context.Context, q Query) (id, location string, err error)
+}
+
+// runner is the Runner implementation
+type runner struct {
+	cli          Client
+	pollInterval time.Duration
+}
+
+// NewRunner returns a Runner implementation polling query executions
+// status with given interval
+func NewRunner(cli Client, pollInterval time.Duration) Runner {
+	return &runner{
+		cli:          cli,
+		pollInterval: pollInterval,
+	}
+}
+
+// Run is the Runner Run implementation
+func (r *runner) Run(ctx context.Context, q Query) (string, string, error) {
+	if q.SQL == "" {
+		out, err := r.cli.GetNamedQuery(ctx, &awsathena.GetNamedQueryInput{
+			NamedQueryId: aws.String(q.NamedQueryID),
+		})
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get named query %s: %w", q.NamedQueryID, err)
+		}
+		q.SQL = aws.ToString(out.NamedQuery.QueryString)
+		if q.Database == "" {
+			q.Database = aws.ToString(out.NamedQuery.Database)
+		}
+		if q.WorkGroup == "" {
+			q.WorkGroup = aws.ToString(out.NamedQuery.WorkGroup)
+		}
+	}
+
+	in := &awsathena.StartQueryExecutionInput{
+		QueryString: aws.String(q.SQL),
+	}
+	if q.WorkGroup != "" {
+		in.WorkGroup = aws.String(q.WorkGroup)
+	}
+	if q.Database != "" {
+		in.QueryExecutionContext = &types.QueryExecutionContext{
+			Database: aws.String(q.Database),
+		}
+	}
+	if q.OutputLocation != "" {
+		in.ResultConfiguration = &types.ResultConfiguration{
+			OutputLocation: aws.String(q.OutputLocation),
+		}
+	}
+	out, err := r.cli.StartQueryExecution(ctx, in)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to start query execution: %w", err)
+	}
+	id := aws.ToString(out.QueryExecutionId)
+
+	location, err := r.wait(ctx, id)
+	return id, location, err
+}
+
+// wait polls given query execution until it finishes and returns its
+// result location
+func (r *runner) wait(ctx context.Context, id string) (string, error) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		out, err := r.cli.GetQueryExecution(ctx, &awsathena.GetQueryExecutionInput{
+			QueryExecutionId: aws.String(id),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to get query execution %s: %w", id, err)
+		}
+
+		qe := out.QueryExecution
+		if qe == nil || qe.Status == nil {
+			return "", fmt.Errorf("query execution %s has no status", id)
+		}
+		switch qe.Status.State {
+		case types.QueryExecutionStateSucceeded:
+			if qe.ResultConfiguration == nil || qe.ResultConfiguration.OutputLocation == nil {
+				return "", fmt.Errorf("query execution %s has no output location", id)
+			}
+			return aws.ToString(qe.ResultConfiguration.OutputLocation), nil
+		case types.QueryExecutionStateFailed, types.QueryExecutionStateCancelled:
+			reason := aws.ToString(qe.Status.StateChangeReason)
+			if e := qe.Status.AthenaError; e != nil && aws.ToString(e.ErrorMessage) != "" {
+				reason = aws.ToString(e.ErrorMessage)
+			}
+			return "", &QueryError{ID: id, State: string(qe.Status.State), Reason: reason}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package athena
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsathena "github.com/aws/aws-sdk-go-v2/service/athena"
+	"github.com/aws/aws-sdk-go-v2/service/athena/types"
+)
+
+// fakeClient is a Client implementation returning given states in turn
+type fakeClient struct {
+	states  []types.QueryExecutionState
+	started *awsathena.StartQueryExecutionInput
+}
+
+func (c *fakeClient) StartQueryExecution(_ context.Context, params *awsathena.StartQueryExecutionInput, _ ...func(*awsathena.Options)) (*awsathena.StartQueryExecutionOutput, error) {
+	c.started = params
+	return &awsathena.StartQueryExecutionOutput{QueryExecutionId: aws.String("foo")}, nil
+}
+
+func (c *fakeClient) GetQueryExecution(_ context.Context, params *awsathena.GetQueryExecutionInput, _ ...func(*awsathena.Options)) (*awsathena.GetQueryExecutionOutput, error) {
+	state := c.states[0]
+	if len(c.states) > 1 {
+		c.states = c.states[1:]
+	}
+	return &awsathena.GetQueryExecutionOutput{
+		QueryExecution: &types.QueryExecution{
+			QueryExecutionId: params.QueryExecutionId,
+			Status: &types.QueryExecutionStatus{
+				State:             state,
+				StateChangeReason: aws.String("bar"),
+			},
+			ResultConfiguration: &types.ResultConfiguration{
+				OutputLocation: aws.String("s3://bucket/results/foo.csv"),
+			},
+		},
+	}, nil
+}
+
+func (c *fakeClient) GetNamedQuery(_ context.Context, _ *awsathena.GetNamedQueryInput, _ ...func(*awsathena.Options)) (*awsathena.GetNamedQueryOutput, error) {
+	return &awsathena.GetNamedQueryOutput{
+		NamedQuery: &types.NamedQuery{
+			QueryString: aws.String("SELECT 2"),
+			Database:    aws.String("named_db"),
+			WorkGroup:   aws.String("named_wg"),
+		},
+	}, nil
+}
+
+func Test_runner_Run(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        Query
+		states       []types.QueryExecutionState
+		wantLocation string
+		wantSQL      string
+		wantDatabase string
+		wantErr      bool
+	}{
+		{
+			name:         "Succeeded query should return its output location",
+			query:        Query{SQL: "SELECT 1", Database: "db", WorkGroup: "wg"},
+			states:       []types.QueryExecutionState{types.QueryExecutionStateQueued, types.QueryExecutionStateRunning, types.QueryExecutionStateSucceeded},
+			wantLocation: "s3://bucket/results/foo.csv",
+			wantSQL:      "SELECT 1",
+			wantDatabase: "db",
+			wantErr:      false,
+		},
+		{
+			name:         "Named query should be resolved",
+			query:        Query{NamedQueryID: "baz"},
+			states:       []types.QueryExecutionState{types.QueryExecutionStateSucceeded},
+			wantLocation: "s3://bucket/results/foo.csv",
+			wantSQL:      "SELECT 2",
+			wantDatabase: "named_db",
+			wantErr:      false,
+		},
+		{
+			name:         "Failed query should return an error",
+			query:        Query{SQL: "SELECT 1"},
+			states:       []types.QueryExecutionState{types.QueryExecutionStateRunning, types.QueryExecutionStateFailed},
+			wantLocation: "",
+			wantSQL:      "SELECT 1",
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := &fakeClient{states: tt.states}
+			r := NewRunner(cli, time.Millisecond)
+			id, location, err := r.Run(context.Background(), tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runner.Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var qErr *QueryError
+			if tt.wantErr && !errors.As(err, &qErr) {
+				t.Errorf("runner.Run() error = %v, want a QueryError", err)
+			}
+			if id != "foo" {
+				t.Errorf("runner.Run() id = %q, want %q", id, "foo")
+			}
+			if location != tt.wantLocation {
+				t.Errorf("runner.Run() location = %q, want %q", location, tt.wantLocation)
+			}
+			if got := aws.ToString(cli.started.QueryString); got != tt.wantSQL {
+				t.Errorf("runner.Run() started SQL = %q, want %q", got, tt.wantSQL)
+			}
+			var db string
+			if cli.started.QueryExecutionContext != nil {
+				db = aws.ToString(cli.started.QueryExecutionContext.Database)
+			}
+			if db != tt.wantDatabase {
+				t.Errorf("runner.Run() started database = %q, want %q", db, tt.wantDatabase)
+			}
+		})
+	}
+}
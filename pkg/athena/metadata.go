@@ -0,0 +1,194 @@
+package athena
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/quortex/influxdb-athena-crawler/pkg/flags"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// MetadataSuffix is the suffix Athena appends to query results keys to
+// store their metadata
+const MetadataSuffix = ".metadata"
+
+// Athena .metadata files are protobuf encoded ResultSetMetadata, whose
+// column infos mirror the API ColumnInfo type (catalog, schema, table,
+// name, label, type, precision, scale, nullable, case sensitive).
+// Only the name and type fields are used.
+const (
+	columnInfoNameField protowire.Number = 4
+	columnInfoTypeField protowire.Number = 6
+)
+
+// fieldTypes maps Athena SQL types to InfluxDB field types
+var fieldTypes = map[string]flags.FieldType{
+	"boolean":   flags.FieldTypeBool,
+	"tinyint":   flags.FieldTypeInteger,
+	"smallint":  flags.FieldTypeInteger,
+	"integer":   flags.FieldTypeInteger,
+	"int":       flags.FieldTypeInteger,
+	"bigint":    flags.FieldTypeInteger,
+	"float":     flags.FieldTypeFloat,
+	"real":      flags.FieldTypeFloat,
+	"double":    flags.FieldTypeFloat,
+	"decimal":   flags.FieldTypeFloat,
+	"char":      flags.FieldTypeString,
+	"varchar":   flags.FieldTypeString,
+	"string":    flags.FieldTypeString,
+	"date":      flags.FieldTypeString,
+	"time":      flags.FieldTypeString,
+	"timestamp": flags.FieldTypeString,
+	"interval":  flags.FieldTypeString,
+	"json":      flags.FieldTypeString,
+	"uuid":      flags.FieldTypeString,
+	"ipaddress": flags.FieldTypeString,
+	"varbinary": flags.FieldTypeString,
+	"array":     flags.FieldTypeString,
+	"map":       flags.FieldTypeString,
+	"row":       flags.FieldTypeString,
+	"struct":    flags.FieldTypeString,
+}
+
+// Column describes a column of an Athena query result
+type Column struct {
+	Name, Type string
+}
+
+// FieldType returns the InfluxDB field type matching the column SQL type
+func (c Column) FieldType() flags.FieldType {
+	if t, ok := fieldTypes[baseType(c.Type)]; ok {
+		return t
+	}
+	return flags.FieldTypeString
+}
+
+// baseType returns given SQL type without its parameters,
+// e.g. "decimal(10,2)" becomes "decimal"
+func baseType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if i := strings.IndexAny(t, "( "); i >= 0 {
+		t = t[:i]
+	}
+	return t
+}
+
+// ParseMetadata parses an Athena query result .metadata file and
+// returns its columns in order.
+func ParseMetadata(r io.Reader) ([]Column, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := parseMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no column found in metadata")
+	}
+	return cols, nil
+}
+
+// parseMessage walks a protobuf message and returns all column infos
+// found in it, at any depth
+func parseMessage(b []byte) ([]Column, error) {
+	cols := []Column{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if col, ok := parseColumnInfo(v); ok {
+			cols = append(cols, col)
+			continue
+		}
+		// Not a column info, it may be a message wrapping column infos
+		// or a plain string, in which case it is ignored
+		if nested, err := parseMessage(v); err == nil {
+			cols = append(cols, nested...)
+		}
+	}
+	return cols, nil
+}
+
+// parseColumnInfo parses given bytes as a column info message, the
+// boolean is false if they do not hold a valid column info
+func parseColumnInfo(b []byte) (Column, bool) {
+	var col Column
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return Column{}, false
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return Column{}, false
+		}
+		if typ == protowire.BytesType && (num == columnInfoNameField || num == columnInfoTypeField) {
+			v, _ := protowire.ConsumeBytes(b)
+			if !utf8.Valid(v) {
+				return Column{}, false
+			}
+			if num == columnInfoNameField {
+				col.Name = string(v)
+			} else {
+				col.Type = string(v)
+			}
+		}
+		b = b[n:]
+	}
+
+	if _, ok := fieldTypes[baseType(col.Type)]; !ok || col.Name == "" {
+		return Column{}, false
+	}
+	return col, true
+}
+
+// InferFields returns InfluxDB fields for given columns, typed from their
+// SQL type. The timestamp and tags rows are skipped and given explicit
+// fields take precedence over inferred ones.
+func InferFields(cols []Column, tsRow string, tags []*flags.Tag, fields []*flags.Field) []*flags.Field {
+	skip := map[string]struct{}{tsRow: {}}
+	for _, t := range tags {
+		skip[t.Row] = struct{}{}
+	}
+	for _, f := range fields {
+		skip[f.Row] = struct{}{}
+		skip[f.Field] = struct{}{}
+	}
+
+	res := make([]*flags.Field, 0, len(cols)+len(fields))
+	res = append(res, fields...)
+	for _, c := range cols {
+		if _, ok := skip[c.Name]; ok {
+			continue
+		}
+		res = append(res, &flags.Field{
+			Field:     c.Name,
+			Row:       c.Name,
+			FieldType: c.FieldType(),
+		})
+	}
+	return res
+}
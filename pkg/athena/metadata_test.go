@@ -0,0 +1,156 @@
+package athena
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/quortex/influxdb-athena-crawler/pkg/flags"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// columnInfo returns a protobuf encoded column info
+func columnInfo(name, typ string) []byte {
+	var b []byte
+	for i, s := range []string{"hive", "default", "foo", name, name, typ} {
+		b = protowire.AppendTag(b, protowire.Number(i+1), protowire.BytesType)
+		b = protowire.AppendString(b, s)
+	}
+	b = protowire.AppendTag(b, 7, protowire.VarintType)
+	b = protowire.AppendVarint(b, 19)
+	return b
+}
+
+// metadata returns a protobuf encoded metadata file for given columns
+func metadata(cols ...[]byte) []byte {
+	var rs []byte
+	for _, c := range cols {
+		rs = protowire.AppendTag(rs, 1, protowire.BytesType)
+		rs = protowire.AppendBytes(rs, c)
+	}
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, 1)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, rs)
+	return b
+}
+
+func Test_ParseMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []Column
+		wantErr bool
+	}{
+		{
+			name:    "Invalid metadata should return an error",
+			data:    []byte{0x0a, 0xff},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "Metadata without columns should return an error",
+			data:    metadata(),
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Columns should be returned in order",
+			data: metadata(
+				columnInfo("timestamp", "timestamp"),
+				columnInfo("publishing_point", "varchar"),
+				columnInfo("audience", "bigint"),
+				columnInfo("ratio", "decimal(10,2)"),
+			),
+			want: []Column{
+				{Name: "timestamp", Type: "timestamp"},
+				{Name: "publishing_point", Type: "varchar"},
+				{Name: "audience", Type: "bigint"},
+				{Name: "ratio", Type: "decimal(10,2)"},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMetadata(bytes.NewReader(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseMetadata() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMetadata() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_InferFields(t *testing.T) {
+	type args struct {
+		cols   []Column
+		tsRow  string
+		tags   []*flags.Tag
+		fields []*flags.Field
+	}
+	tests := []struct {
+		name string
+		args args
+		want []*flags.Field
+	}{
+		{
+			name: "Fields should be typed from SQL types",
+			args: args{
+				cols: []Column{
+					{Name: "live", Type: "boolean"},
+					{Name: "audience", Type: "bigint"},
+					{Name: "ratio", Type: "double"},
+					{Name: "comment", Type: "varchar"},
+				},
+			},
+			want: []*flags.Field{
+				{Field: "live", Row: "live", FieldType: flags.FieldTypeBool},
+				{Field: "audience", Row: "audience", FieldType: flags.FieldTypeInteger},
+				{Field: "ratio", Row: "ratio", FieldType: flags.FieldTypeFloat},
+				{Field: "comment", Row: "comment", FieldType: flags.FieldTypeString},
+			},
+		},
+		{
+			name: "Timestamp and tags rows should be skipped",
+			args: args{
+				cols: []Column{
+					{Name: "timestamp", Type: "timestamp"},
+					{Name: "publishing_point", Type: "varchar"},
+					{Name: "audience", Type: "bigint"},
+				},
+				tsRow: "timestamp",
+				tags:  []*flags.Tag{{Tag: "pp", Row: "publishing_point"}},
+			},
+			want: []*flags.Field{
+				{Field: "audience", Row: "audience", FieldType: flags.FieldTypeInteger},
+			},
+		},
+		{
+			name: "Explicit fields should override inferred ones",
+			args: args{
+				cols: []Column{
+					{Name: "audience", Type: "bigint"},
+					{Name: "ratio", Type: "double"},
+				},
+				fields: []*flags.Field{{Field: "audience", Row: "audience", FieldType: flags.FieldTypeFloat}},
+			},
+			want: []*flags.Field{
+				{Field: "audience", Row: "audience", FieldType: flags.FieldTypeFloat},
+				{Field: "ratio", Row: "ratio", FieldType: flags.FieldTypeFloat},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := InferFields(tt.args.cols, tt.args.tsRow, tt.args.tags, tt.args.fields)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("InferFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
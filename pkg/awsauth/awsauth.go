@@ -0,0 +1,42 @@
+// Package awsauth provides the AWS credentials the crawler runs with
+package awsauth
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+)
+
+// DefaultSessionName is the session name of assumed roles if none is given
+const DefaultSessionName = "influxdb-athena-crawler"
+
+// Role describes an IAM role to assume
+type Role struct {
+	// ARN is the role ARN, no role is assumed if empty
+	ARN string
+	// ExternalID is the external ID required by the role trust policy, if any
+	ExternalID string
+	// SessionName identifies the role session, e.g. in CloudTrail
+	SessionName string
+}
+
+// AssumeRole returns a copy of given config whose credentials are those
+// of given role, assumed through given STS client with the config
+// credentials. Credentials are cached and refreshed before they expire.
+// The config is returned as is if no role ARN is given.
+func AssumeRole(cfg aws.Config, cli stscreds.AssumeRoleAPIClient, role Role) aws.Config {
+	if role.ARN == "" {
+		return cfg
+	}
+	provider := stscreds.NewAssumeRoleProvider(cli, role.ARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = role.SessionName
+		if o.RoleSessionName == "" {
+			o.RoleSessionName = DefaultSessionName
+		}
+		if role.ExternalID != "" {
+			o.ExternalID = aws.String(role.ExternalID)
+		}
+	})
+	res := cfg.Copy()
+	res.Credentials = aws.NewCredentialsCache(provider)
+	return res
+}
@@ -0,0 +1,110 @@
+package awsauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// fakeSTS is an AssumeRoleAPIClient returning credentials expiring after
+// a configured duration
+type fakeSTS struct {
+	expiresIn time.Duration
+	inputs    []*sts.AssumeRoleInput
+}
+
+func (f *fakeSTS) AssumeRole(_ context.Context, params *sts.AssumeRoleInput, _ ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	f.inputs = append(f.inputs, params)
+	return &sts.AssumeRoleOutput{
+		Credentials: &types.Credentials{
+			AccessKeyId:     aws.String("assumed"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(f.expiresIn)),
+		},
+	}, nil
+}
+
+func TestAssumeRole(t *testing.T) {
+	base := aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("static", "secret", ""),
+	}
+
+	tests := []struct {
+		name            string
+		role            Role
+		expiresIn       time.Duration
+		wantKeyID       string
+		wantCalls       int
+		wantSessionName string
+		wantExternalID  *string
+	}{
+		{
+			name:      "no role should keep config credentials",
+			wantKeyID: "static",
+		},
+		{
+			name:            "role should be assumed with default session name",
+			role:            Role{ARN: "arn:aws:iam::123456789012:role/crawler"},
+			expiresIn:       time.Hour,
+			wantKeyID:       "assumed",
+			wantCalls:       1,
+			wantSessionName: DefaultSessionName,
+		},
+		{
+			name:            "role should be assumed with external ID and session name",
+			role:            Role{ARN: "arn:aws:iam::123456789012:role/crawler", ExternalID: "ext", SessionName: "foo"},
+			expiresIn:       time.Hour,
+			wantKeyID:       "assumed",
+			wantCalls:       1,
+			wantSessionName: "foo",
+			wantExternalID:  aws.String("ext"),
+		},
+		{
+			name:            "expired credentials should be refreshed",
+			role:            Role{ARN: "arn:aws:iam::123456789012:role/crawler"},
+			expiresIn:       -time.Minute,
+			wantKeyID:       "assumed",
+			wantCalls:       2,
+			wantSessionName: DefaultSessionName,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := &fakeSTS{expiresIn: tt.expiresIn}
+			cfg := AssumeRole(base, cli, tt.role)
+			for i := 0; i < 2; i++ {
+				creds, err := cfg.Credentials.Retrieve(context.Background())
+				if err != nil {
+					t.Fatalf("Retrieve() error = %v", err)
+				}
+				if creds.AccessKeyID != tt.wantKeyID {
+					t.Errorf("Retrieve() AccessKeyID = %q, want %q", creds.AccessKeyID, tt.wantKeyID)
+				}
+			}
+			if len(cli.inputs) != tt.wantCalls {
+				t.Fatalf("AssumeRole() calls = %d, want %d", len(cli.inputs), tt.wantCalls)
+			}
+			for _, in := range cli.inputs {
+				if aws.ToString(in.RoleArn) != tt.role.ARN {
+					t.Errorf("AssumeRole() RoleArn = %q, want %q", aws.ToString(in.RoleArn), tt.role.ARN)
+				}
+				if aws.ToString(in.RoleSessionName) != tt.wantSessionName {
+					t.Errorf("AssumeRole() RoleSessionName = %q, want %q", aws.ToString(in.RoleSessionName), tt.wantSessionName)
+				}
+				if aws.ToString(in.ExternalId) != aws.ToString(tt.wantExternalID) {
+					t.Errorf("AssumeRole() ExternalId = %q, want %q", aws.ToString(in.ExternalId), aws.ToString(tt.wantExternalID))
+				}
+			}
+			if base.Credentials == cfg.Credentials && tt.role.ARN != "" {
+				t.Errorf("AssumeRole() modified given config credentials")
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package compress
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec describes a compression codec
+type Codec string
+
+// All supported compression codecs
+const (
+	CodecNone  Codec = ""
+	CodecGzip  Codec = "gzip"
+	CodecZstd  Codec = "zstd"
+	CodecBzip2 Codec = "bzip2"
+)
+
+// extensions maps key extensions to their compression codec
+var extensions = map[string]Codec{
+	".gz":   CodecGzip,
+	".gzip": CodecGzip,
+	".zst":  CodecZstd,
+	".zstd": CodecZstd,
+	".bz2":  CodecBzip2,
+}
+
+// encodings maps Content-Encoding values to their compression codec
+var encodings = map[string]Codec{
+	"gzip":    CodecGzip,
+	"x-gzip":  CodecGzip,
+	"zstd":    CodecZstd,
+	"bzip2":   CodecBzip2,
+	"x-bzip2": CodecBzip2,
+}
+
+// ext returns the compression extension of given key, if any
+func ext(key string) string {
+	i := strings.LastIndex(key, ".")
+	if i < 0 || strings.Contains(key[i:], "/") {
+		return ""
+	}
+	e := strings.ToLower(key[i:])
+	if _, ok := extensions[e]; !ok {
+		return ""
+	}
+	return key[i:]
+}
+
+// Detect returns the compression codec of an object from its key
+// extension, falling back to its Content-Encoding.
+func Detect(key, contentEncoding string) Codec {
+	if e := ext(key); e != "" {
+		return extensions[strings.ToLower(e)]
+	}
+	return encodings[strings.ToLower(strings.TrimSpace(contentEncoding))]
+}
+
+// TrimExt returns given key without its compression extension,
+// e.g. "foo.csv.gz" becomes "foo.csv".
+func TrimExt(key string) string {
+	return strings.TrimSuffix(key, ext(key))
+}
+
+// FormatError describes an invalid compressed stream (bad header,
+// corrupted or truncated data...)
+type FormatError struct {
+	Codec Codec
+	Err   error
+}
+
+// Error is the error implementation for FormatError
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("invalid %s content: %v", e.Codec, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+// NewReader returns a reader decompressing given reader with given codec.
+// Decompression errors are returned as *FormatError, errors of given
+// reader as is.
+func NewReader(r io.Reader, c Codec) (io.ReadCloser, error) {
+	switch c {
+	case CodecNone:
+		return io.NopCloser(r), nil
+	case CodecGzip, CodecZstd, CodecBzip2:
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %q", c)
+	}
+	src := &sourceReader{r: r}
+	d, err := newDecoder(src, c)
+	if err != nil {
+		return nil, src.formatError(c, err)
+	}
+	return &decoder{ReadCloser: d, src: src, c: c}, nil
+}
+
+// newDecoder returns a reader decompressing given reader with given
+// supported codec
+func newDecoder(r io.Reader, c Codec) (io.ReadCloser, error) {
+	switch c {
+	case CodecGzip:
+		return gzip.NewReader(r)
+	case CodecZstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	}
+}
+
+// sourceReader records the first error of the compressed reader, so that
+// it is not mistaken for a decompression one
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+// Read is the io.Reader Read implementation for sourceReader
+func (s *sourceReader) Read(b []byte) (int, error) {
+	n, err := s.r.Read(b)
+	if err != nil && err != io.EOF && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// formatError returns given decoder error as a *FormatError, unless
+// reading the compressed content failed
+func (s *sourceReader) formatError(c Codec, err error) error {
+	if s.err != nil {
+		return err
+	}
+	return &FormatError{Codec: c, Err: err}
+}
+
+// decoder decompresses a stream, returning decompression errors as
+// *FormatError
+type decoder struct {
+	io.ReadCloser
+	src *sourceReader
+	c   Codec
+}
+
+// Read is the io.Reader Read implementation for decoder
+func (d *decoder) Read(b []byte) (int, error) {
+	n, err := d.ReadCloser.Read(b)
+	if err != nil && err != io.EOF {
+		err = d.src.formatError(d.c, err)
+	}
+	return n, err
+}
@@ -0,0 +1,253 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func Test_Detect(t *testing.T) {
+	type args struct {
+		key             string
+		contentEncoding string
+	}
+	tests := []struct {
+		name string
+		args args
+		want Codec
+	}{
+		{
+			name: "Uncompressed key should not be detected",
+			args: args{key: "foo/bar.csv"},
+			want: CodecNone,
+		},
+		{
+			name: "Gzip extension should be detected",
+			args: args{key: "foo/bar.csv.gz"},
+			want: CodecGzip,
+		},
+		{
+			name: "Extension detection should be case insensitive",
+			args: args{key: "foo/bar.CSV.GZ"},
+			want: CodecGzip,
+		},
+		{
+			name: "Zstd extension should be detected",
+			args: args{key: "foo/bar.csv.zst"},
+			want: CodecZstd,
+		},
+		{
+			name: "Bzip2 extension should be detected",
+			args: args{key: "foo/bar.csv.bz2"},
+			want: CodecBzip2,
+		},
+		{
+			name: "Content-Encoding should be used without extension",
+			args: args{key: "foo/bar.csv", contentEncoding: "gzip"},
+			want: CodecGzip,
+		},
+		{
+			name: "Extension should take precedence over Content-Encoding",
+			args: args{key: "foo/bar.csv.zst", contentEncoding: "gzip"},
+			want: CodecZstd,
+		},
+		{
+			name: "Dots in directories should be ignored",
+			args: args{key: "foo.gz/bar"},
+			want: CodecNone,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.args.key, tt.args.contentEncoding); got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_TrimExt(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{
+			name: "Uncompressed key should be left untouched",
+			key:  "foo/bar.csv",
+			want: "foo/bar.csv",
+		},
+		{
+			name: "Compression extension should be trimmed",
+			key:  "foo/bar.csv.gz",
+			want: "foo/bar.csv",
+		},
+		{
+			name: "Only the last extension should be trimmed",
+			key:  "foo/bar.gz.zst",
+			want: "foo/bar.gz",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimExt(tt.key); got != tt.want {
+				t.Errorf("TrimExt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_NewReader(t *testing.T) {
+	const content = "timestamp,foo\n2021-06-24T06:00:00.000Z,bar\n"
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	if _, err := gw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	gw.Close()
+
+	var zst bytes.Buffer
+	zw, err := zstd.NewWriter(&zst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	zw.Close()
+
+	tests := []struct {
+		name    string
+		data    []byte
+		codec   Codec
+		wantErr bool
+	}{
+		{
+			name:  "Uncompressed content should be read as is",
+			data:  []byte(content),
+			codec: CodecNone,
+		},
+		{
+			name:  "Gzip content should be decompressed",
+			data:  gz.Bytes(),
+			codec: CodecGzip,
+		},
+		{
+			name:  "Zstd content should be decompressed",
+			data:  zst.Bytes(),
+			codec: CodecZstd,
+		},
+		{
+			name:    "Unsupported codec should return an error",
+			data:    []byte(content),
+			codec:   Codec("foo"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(tt.data), tt.codec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewReader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("NewReader() read error = %v", err)
+			}
+			if string(got) != content {
+				t.Errorf("NewReader() = %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+// failingReader fails with its error once its content is read
+type failingReader struct {
+	io.Reader
+	err error
+}
+
+func (f *failingReader) Read(b []byte) (int, error) {
+	n, err := f.Reader.Read(b)
+	if err == io.EOF {
+		err = f.err
+	}
+	return n, err
+}
+
+func Test_NewReader_errors(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	if _, err := gw.Write(bytes.Repeat([]byte("foo,bar\n"), 1000)); err != nil {
+		t.Fatal(err)
+	}
+	gw.Close()
+	errRead := errors.New("connection reset")
+
+	tests := []struct {
+		name            string
+		r               io.Reader
+		codec           Codec
+		wantFormatError bool
+	}{
+		{
+			name:            "Invalid header should be a format error",
+			r:               strings.NewReader("foo,bar\n"),
+			codec:           CodecGzip,
+			wantFormatError: true,
+		},
+		{
+			name:            "Truncated content should be a format error",
+			r:               bytes.NewReader(gz.Bytes()[:gz.Len()/2]),
+			codec:           CodecGzip,
+			wantFormatError: true,
+		},
+		{
+			name:            "Invalid zstd content should be a format error",
+			r:               strings.NewReader("foo,bar\n"),
+			codec:           CodecZstd,
+			wantFormatError: true,
+		},
+		{
+			name:            "Invalid bzip2 content should be a format error",
+			r:               strings.NewReader("foo,bar\n"),
+			codec:           CodecBzip2,
+			wantFormatError: true,
+		},
+		{
+			name:            "Read failure should not be a format error",
+			r:               &failingReader{Reader: bytes.NewReader(gz.Bytes()[:gz.Len()/2]), err: errRead},
+			codec:           CodecGzip,
+			wantFormatError: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(tt.r, tt.codec)
+			if err == nil {
+				defer r.Close()
+				_, err = io.ReadAll(r)
+			}
+			if err == nil {
+				t.Fatalf("NewReader() read error = nil, want an error")
+			}
+			var fErr *FormatError
+			if errors.As(err, &fErr) != tt.wantFormatError {
+				t.Errorf("NewReader() error = %v, wantFormatError %v", err, tt.wantFormatError)
+			}
+			if !tt.wantFormatError && !errors.Is(err, errRead) {
+				t.Errorf("NewReader() error = %v, want %v", err, errRead)
+			}
+		})
+	}
+}
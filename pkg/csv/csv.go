@@ -1,39 +1,446 @@
 package csv
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/csv"
+	"errors"
+	"fmt"
 	"io"
 	"strings"
+	"unicode"
 )
 
-// parseString parses a CSV string to a map[string]interface{} slice
-func ParseString(strCSV string) ([]map[string]interface{}, error) {
-	// Read CSV object
-	var header []string
-	res := []map[string]interface{}{}
+// RowShape describes how rows whose fields count differs from the header
+// one (ragged rows) are handled
+type RowShape string
 
-	reader := csv.NewReader(strings.NewReader(strCSV))
-	for {
-		line, err := reader.Read()
-		if err == io.EOF {
+// All row shape policies
+const (
+	// RowShapeStrict fails on ragged rows
+	RowShapeStrict RowShape = "strict"
+	// RowShapePad fills missing trailing fields with empty values, extra
+	// fields are an error
+	RowShapePad RowShape = "pad"
+	// RowShapeTruncate drops extra fields and fills missing trailing
+	// fields with empty values
+	RowShapeTruncate RowShape = "truncate"
+	// RowShapeSkip skips ragged rows
+	RowShapeSkip RowShape = "skip"
+)
+
+// FieldCountError describes a ragged row
+type FieldCountError struct {
+	// Line is the line the row starts on
+	Line int
+	// Column is the first missing column, empty if the row has extra fields
+	Column string
+	// Fields is the row fields count, Expected the header one
+	Fields, Expected int
+}
+
+// Error is the error implementation for FieldCountError
+func (e *FieldCountError) Error() string {
+	if e.Column != "" {
+		return fmt.Sprintf("line %d, column %q: missing field, %d fields instead of %d", e.Line, e.Column, e.Fields, e.Expected)
+	}
+	return fmt.Sprintf("line %d: extra fields, %d fields instead of %d", e.Line, e.Fields, e.Expected)
+}
+
+// HeaderCase describes how header fields are cased
+type HeaderCase string
+
+// All header cases
+const (
+	// HeaderCaseKeep keeps header fields as is
+	HeaderCaseKeep HeaderCase = "keep"
+	// HeaderCaseLower lower cases header fields
+	HeaderCaseLower HeaderCase = "lower"
+	// HeaderCaseSnake converts header fields to snake_case
+	HeaderCaseSnake HeaderCase = "snake"
+)
+
+// DuplicateColumns describes how columns whose name is already taken by a
+// previous one are handled
+type DuplicateColumns string
+
+// All duplicate columns policies
+const (
+	// DuplicateColumnsSuffix suffixes duplicate columns with their
+	// occurrence index, e.g. foo, foo_2, foo_3
+	DuplicateColumnsSuffix DuplicateColumns = "suffix"
+	// DuplicateColumnsFail fails on duplicate columns
+	DuplicateColumnsFail DuplicateColumns = "fail"
+	// DuplicateColumnsFirst keeps the first column and ignores duplicates
+	DuplicateColumnsFirst DuplicateColumns = "first"
+)
+
+// DuplicateColumnError describes a header with a duplicate column
+type DuplicateColumnError struct {
+	// Line is the header line, 0 for columns given by the dialect
+	Line   int
+	Column string
+}
+
+// Error is the error implementation for DuplicateColumnError
+func (e *DuplicateColumnError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("column %q: duplicate column", e.Column)
+	}
+	return fmt.Sprintf("line %d, column %q: duplicate column", e.Line, e.Column)
+}
+
+// Dialect describes how CSV lines are written, its zero value describes
+// comma separated lines whose first one holds the header fields
+type Dialect struct {
+	// Delimiter is the fields delimiter, a comma if 0
+	Delimiter rune
+	// LazyQuotes allows quotes in unquoted fields and non doubled quotes
+	// in quoted fields
+	LazyQuotes bool
+	// Comment is the character starting comment lines, which are ignored,
+	// comments are not allowed if 0
+	Comment rune
+	// SkipLeadingLines is how many lines to ignore before the header
+	SkipLeadingLines int
+	// SkipTrailingLines is how many lines to ignore at the end
+	SkipTrailingLines int
+	// Columns are the fields names of header-less lines, the first line
+	// holds them if empty
+	Columns []string
+	// RowShape is how ragged rows are handled, they are errors if empty
+	RowShape RowShape
+	// HeaderCase is how header fields are cased, they are kept as is if
+	// empty. Header fields are always trimmed.
+	HeaderCase HeaderCase
+	// DuplicateColumns is how duplicate columns are handled, they are
+	// suffixed if empty
+	DuplicateColumns DuplicateColumns
+}
+
+// Reader reads rows from a CSV stream one at a time, its first line
+// holding the header fields unless the dialect defines columns
+type Reader struct {
+	r  *csv.Reader
+	br *bufio.Reader
+	d  Dialect
+	// header holds the fields of kept columns, columns the field of each
+	// column, empty for ignored ones (empty or duplicate fields)
+	header  []string
+	columns []string
+	line    int
+	started bool
+	// skip is how many leading lines are to be skipped before the first
+	// read, skippedLines how many were
+	skip, skippedLines int
+	skippedRows        int
+}
+
+// NewReader returns a Reader reading CSV lines of given dialect from
+// given reader
+func NewReader(r io.Reader, d Dialect) *Reader {
+	br := bufio.NewReader(r)
+	var lines io.Reader = br
+	if d.SkipTrailingLines > 0 {
+		lines = &trailingSkipper{r: br, n: d.SkipTrailingLines}
+	}
+
+	cr := csv.NewReader(lines)
+	cr.ReuseRecord = true
+	// Ragged rows are handled according to the row shape
+	cr.FieldsPerRecord = -1
+	if d.Delimiter != 0 {
+		cr.Comma = d.Delimiter
+	}
+	cr.LazyQuotes = d.LazyQuotes
+	cr.Comment = d.Comment
+	return &Reader{r: cr, br: br, d: d, skip: d.SkipLeadingLines}
+}
+
+// Header returns the header fields, normalized and deduplicated, reading
+// them if no row was read yet. Columns with an empty field are ignored.
+// It returns io.EOF if the stream is empty.
+func (r *Reader) Header() ([]string, error) {
+	if r.columns != nil {
+		return r.header, nil
+	}
+	fields := r.d.Columns
+	line := 0
+	if len(fields) == 0 {
+		var err error
+		if fields, err = r.read(); err != nil {
+			return nil, err
+		}
+		line = r.line
+	}
+
+	columns, err := r.d.columns(fields, line)
+	if err != nil {
+		return nil, err
+	}
+	r.columns = columns
+	r.header = make([]string, 0, len(columns))
+	for _, name := range columns {
+		if name != "" {
+			r.header = append(r.header, name)
+		}
+	}
+	return r.header, nil
+}
+
+// HeaderNames returns the names given header fields are read as,
+// normalized and deduplicated the same way as the Header ones. Names of
+// ignored columns are empty.
+func (d Dialect) HeaderNames(fields []string) ([]string, error) {
+	return d.columns(fields, 0)
+}
+
+// columns returns the names of given header fields, duplicate column
+// errors being located at given line
+func (d Dialect) columns(fields []string, line int) ([]string, error) {
+	// Suffixed duplicates must not take the name of a later column
+	names := make([]string, len(fields))
+	reserved := make(map[string]bool, len(fields))
+	for i, f := range fields {
+		names[i] = normalizeField(f, d.HeaderCase)
+		reserved[names[i]] = true
+	}
+
+	columns := make([]string, len(fields))
+	seen := make(map[string]bool, len(fields))
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			switch d.DuplicateColumns {
+			case DuplicateColumnsFail:
+				return nil, &DuplicateColumnError{Line: line, Column: name}
+			case DuplicateColumnsFirst:
+				continue
+			default:
+				name = suffixField(name, reserved)
+				reserved[name] = true
+			}
+		}
+		seen[name] = true
+		columns[i] = name
+	}
+	return columns, nil
+}
+
+// Read returns the next row as a map[string]interface{} keyed by header
+// fields, or io.EOF once all rows are read.
+// Reading stops with the context error once given context is done.
+func (r *Reader) Read(ctx context.Context) (map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := r.Header(); err != nil {
+		return nil, err
+	}
+	line, err := r.read()
+	for r.d.RowShape == RowShapeSkip && err == nil && len(line) != len(r.columns) {
+		r.skippedRows++
+		line, err = r.read()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < len(r.columns) && r.d.RowShape != RowShapePad && r.d.RowShape != RowShapeTruncate ||
+		len(line) > len(r.columns) && r.d.RowShape != RowShapeTruncate {
+		fcErr := &FieldCountError{Line: r.line, Fields: len(line), Expected: len(r.columns)}
+		if len(line) < len(r.columns) {
+			fcErr.Column = r.columns[len(line)]
+		}
+		return nil, fcErr
+	}
+
+	// Missing fields of padded rows are empty, extra fields of truncated
+	// ones are dropped
+	row := make(map[string]interface{}, len(r.header))
+	for i, c := range r.columns {
+		if c == "" {
+			continue
+		}
+		if i < len(line) {
+			row[c] = line[i]
+		} else {
+			row[c] = ""
+		}
+	}
+	return row, nil
+}
+
+// SkippedRows returns how many ragged rows were skipped
+func (r *Reader) SkippedRows() int {
+	return r.skippedRows
+}
+
+// Line returns the line (starting at 1) the last header or row read
+// starts on, quoted fields may span several lines
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// read reads the next CSV line, recording its line number. Line numbers,
+// including those of parse errors, account for skipped leading lines.
+func (r *Reader) read() ([]string, error) {
+	if !r.started {
+		// A UTF-8 byte order mark may start the stream
+		r.started = true
+		if b, _ := r.br.Peek(len(bom)); bytes.Equal(b, bom) {
+			_, _ = r.br.Discard(len(bom))
+		}
+	}
+	for ; r.skip > 0; r.skip-- {
+		if _, err := r.br.ReadBytes('\n'); err == io.EOF {
+			r.skip = 0
 			break
 		} else if err != nil {
 			return nil, err
 		}
+		r.skippedLines++
+	}
+
+	line, err := r.r.Read()
+	var pErr *csv.ParseError
+	if errors.As(err, &pErr) {
+		pErr.StartLine += r.skippedLines
+		pErr.Line += r.skippedLines
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.line, _ = r.r.FieldPos(0)
+	r.line += r.skippedLines
+	return line, nil
+}
+
+// bom is the UTF-8 byte order mark
+var bom = []byte{0xEF, 0xBB, 0xBF}
 
-		// First line contains header fields
-		if header == nil {
-			header = line
+// normalizeField returns given header field trimmed and cased
+func normalizeField(f string, c HeaderCase) string {
+	f = strings.TrimSpace(strings.TrimPrefix(f, string(bom)))
+	switch c {
+	case HeaderCaseLower:
+		return strings.ToLower(f)
+	case HeaderCaseSnake:
+		return snakeCase(f)
+	}
+	return f
+}
+
+// snakeCase converts given field to snake_case, words being delimited by
+// non alphanumeric characters or case changes (e.g. "Publishing Point",
+// "publishingPoint" and "HTTPStatus" become "publishing_point",
+// "publishing_point" and "http_status")
+func snakeCase(f string) string {
+	var b strings.Builder
+	runes := []rune(f)
+	sep := false
+	for i, c := range runes {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			sep = b.Len() > 0
 			continue
 		}
+		if unicode.IsUpper(c) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+				sep = b.Len() > 0
+			}
+		}
+		if sep {
+			b.WriteByte('_')
+			sep = false
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
 
-		// Other lines contains rows
-		row := make(map[string]interface{}, len(header))
-		for i, e := range line {
-			row[header[i]] = e
+// suffixField returns given duplicate field suffixed with the lowest
+// index (starting at 2) not reserved yet
+func suffixField(f string, reserved map[string]bool) string {
+	for i := 2; ; i++ {
+		if name := fmt.Sprintf("%s_%d", f, i); !reserved[name] {
+			return name
+		}
+	}
+}
+
+// trailingSkipper is a reader withholding the n last lines of the
+// underlying one
+type trailingSkipper struct {
+	r *bufio.Reader
+	n int
+	// lines are the lines read ahead, up to n
+	lines [][]byte
+	buf   bytes.Buffer
+	eof   bool
+}
+
+// Read is the io.Reader Read implementation for trailingSkipper
+func (t *trailingSkipper) Read(b []byte) (int, error) {
+	for t.buf.Len() == 0 {
+		if t.eof {
+			return 0, io.EOF
+		}
+		line, err := t.r.ReadBytes('\n')
+		if len(line) > 0 {
+			t.lines = append(t.lines, line)
+		}
+		if err == io.EOF {
+			t.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+		if len(t.lines) > t.n {
+			t.buf.Write(t.lines[0])
+			t.lines = t.lines[1:]
 		}
-		res = append(res, row)
 	}
+	return t.buf.Read(b)
+}
 
+// ParseString parses a CSV string to a map[string]interface{} slice
+func ParseString(strCSV string) ([]map[string]interface{}, error) {
+	res := []map[string]interface{}{}
+	err := ParseReader(strings.NewReader(strCSV), func(row map[string]interface{}) error {
+		res = append(res, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 	return res, nil
 }
+
+// ParseReader reads CSV lines from given reader and calls fn for each
+// row as a map[string]interface{}, one line at a time.
+// Parsing stops at the first error returned by fn.
+func ParseReader(r io.Reader, fn func(row map[string]interface{}) error) error {
+	_, err := ParseDialect(context.Background(), r, Dialect{}, fn)
+	return err
+}
+
+// ParseDialect is ParseReader for CSV lines of given dialect, parsing
+// stopping with the context error once given context is done.
+// It returns how many ragged rows were skipped.
+func ParseDialect(ctx context.Context, r io.Reader, d Dialect, fn func(row map[string]interface{}) error) (int, error) {
+	reader := NewReader(r, d)
+	for {
+		row, err := reader.Read(ctx)
+		if err == io.EOF {
+			return reader.SkippedRows(), nil
+		} else if err != nil {
+			return reader.SkippedRows(), err
+		}
+		if err := fn(row); err != nil {
+			return reader.SkippedRows(), err
+		}
+	}
+}
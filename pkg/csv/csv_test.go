@@ -1,7 +1,12 @@
 package csv
 
 import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -95,3 +100,467 @@ func Test_ParseString(t *testing.T) {
 		})
 	}
 }
+
+func Test_ParseReader(t *testing.T) {
+	errStop := errors.New("stop")
+	type args struct {
+		strCSV  string
+		stopAt  int
+		stopErr error
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    int
+		wantErr error
+	}{
+		{
+			name: "Each row should be passed to the callback",
+			args: args{
+				strCSV: `"timestamp","publishing_point","audience"
+"2021-06-24T06:00:00.000Z","/foo_bar_00","6892"
+"2021-06-24T06:00:00.000Z","/foo_bar_01","7945"
+"2021-06-24T06:00:00.000Z","/foo_bar_02","12157"`,
+			},
+			want:    3,
+			wantErr: nil,
+		},
+		{
+			name: "Header only CSV should not call the callback",
+			args: args{
+				strCSV: `"timestamp","publishing_point","audience"`,
+			},
+			want:    0,
+			wantErr: nil,
+		},
+		{
+			name: "Callback error should stop parsing",
+			args: args{
+				strCSV: `"timestamp","publishing_point","audience"
+"2021-06-24T06:00:00.000Z","/foo_bar_00","6892"
+"2021-06-24T06:00:00.000Z","/foo_bar_01","7945"
+"2021-06-24T06:00:00.000Z","/foo_bar_02","12157"`,
+				stopAt:  2,
+				stopErr: errStop,
+			},
+			want:    2,
+			wantErr: errStop,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := 0
+			err := ParseReader(strings.NewReader(tt.args.strCSV), func(row map[string]interface{}) error {
+				got++
+				if got == tt.args.stopAt {
+					return tt.args.stopErr
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseReader() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseReader() rows = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader(`"timestamp","publishing_point","audience"
+"2021-06-24T06:00:00.000Z","/foo_bar_00","6892"
+"2021-06-24T06:00:00.000Z","/foo
+bar_01","7945"
+"2021-06-24T06:00:00.000Z","/foo_bar_02","12157"`), Dialect{})
+
+	header, err := r.Header()
+	if err != nil {
+		t.Fatalf("Header() error = %v", err)
+	}
+	if want := []string{"timestamp", "publishing_point", "audience"}; !reflect.DeepEqual(header, want) {
+		t.Errorf("Header() = %v, want %v", header, want)
+	}
+	if r.Line() != 1 {
+		t.Errorf("Line() = %d, want 1", r.Line())
+	}
+
+	wantRows := []struct {
+		line int
+		pp   string
+	}{
+		{line: 2, pp: "/foo_bar_00"},
+		{line: 3, pp: "/foo\nbar_01"},
+		{line: 5, pp: "/foo_bar_02"},
+	}
+	for _, want := range wantRows {
+		row, err := r.Read(context.Background())
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if row["publishing_point"] != want.pp {
+			t.Errorf("Read() publishing_point = %q, want %q", row["publishing_point"], want.pp)
+		}
+		if r.Line() != want.line {
+			t.Errorf("Line() = %d, want %d", r.Line(), want.line)
+		}
+	}
+	if _, err := r.Read(context.Background()); err != io.EOF {
+		t.Errorf("Read() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestReader_empty(t *testing.T) {
+	r := NewReader(strings.NewReader(""), Dialect{})
+	if _, err := r.Header(); err != io.EOF {
+		t.Errorf("Header() error = %v, want %v", err, io.EOF)
+	}
+	if _, err := r.Read(context.Background()); err != io.EOF {
+		t.Errorf("Read() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestReader_canceled(t *testing.T) {
+	r := NewReader(strings.NewReader(`"timestamp","audience"
+"2021-06-24T06:00:00.000Z","6892"`), Dialect{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.Read(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Read() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func Test_ParseDialect(t *testing.T) {
+	tests := []struct {
+		name     string
+		strCSV   string
+		dialect  Dialect
+		want     []map[string]interface{}
+		wantLine int
+		wantErr  bool
+	}{
+		{
+			name:    "TSV should be parsed with a tab delimiter",
+			strCSV:  "timestamp\taudience\n2021-06-24T06:00:00.000Z\t6892\n",
+			dialect: Dialect{Delimiter: '\t'},
+			want: []map[string]interface{}{
+				{"timestamp": "2021-06-24T06:00:00.000Z", "audience": "6892"},
+			},
+		},
+		{
+			name:    "Semicolon delimited lines should be parsed",
+			strCSV:  "timestamp;audience\n2021-06-24T06:00:00.000Z;6892\n",
+			dialect: Dialect{Delimiter: ';'},
+			want: []map[string]interface{}{
+				{"timestamp": "2021-06-24T06:00:00.000Z", "audience": "6892"},
+			},
+		},
+		{
+			name:    "Bare quotes should return an error",
+			strCSV:  "timestamp|name\n2021-06-24T06:00:00.000Z|foo \"bar\"\n",
+			dialect: Dialect{Delimiter: '|'},
+			wantErr: true,
+		},
+		{
+			name:    "Bare quotes should be parsed with lazy quotes",
+			strCSV:  "timestamp|name\n2021-06-24T06:00:00.000Z|foo \"bar\"\n",
+			dialect: Dialect{Delimiter: '|', LazyQuotes: true},
+			want: []map[string]interface{}{
+				{"timestamp": "2021-06-24T06:00:00.000Z", "name": `foo "bar"`},
+			},
+		},
+		{
+			name:    "Comment lines should be ignored",
+			strCSV:  "# exported by foo\ntimestamp,audience\n# bar\n2021-06-24T06:00:00.000Z,6892\n",
+			dialect: Dialect{Comment: '#'},
+			want: []map[string]interface{}{
+				{"timestamp": "2021-06-24T06:00:00.000Z", "audience": "6892"},
+			},
+		},
+		{
+			name:    "Leading and trailing lines should be skipped",
+			strCSV:  "Audience report\n\"generated, today\"\ntimestamp,audience\n2021-06-24T06:00:00.000Z,6892\n2021-06-24T07:00:00.000Z,7945\nTotal: 2 rows, \"14837\n",
+			dialect: Dialect{SkipLeadingLines: 2, SkipTrailingLines: 1},
+			want: []map[string]interface{}{
+				{"timestamp": "2021-06-24T06:00:00.000Z", "audience": "6892"},
+				{"timestamp": "2021-06-24T07:00:00.000Z", "audience": "7945"},
+			},
+		},
+		{
+			name:     "Parse errors should be located after skipped lines",
+			strCSV:   "Audience report\ntimestamp,audience\n2021-06-24T06:00:00.000Z,6892\n2021-06-24T07:00:00.000Z,\"79\"45\n",
+			dialect:  Dialect{SkipLeadingLines: 1},
+			wantLine: 4,
+			wantErr:  true,
+		},
+		{
+			name:    "Skipping more lines than available should not return any row",
+			strCSV:  "timestamp,audience\n2021-06-24T06:00:00.000Z,6892",
+			dialect: Dialect{SkipLeadingLines: 1, SkipTrailingLines: 3},
+			want:    []map[string]interface{}{},
+		},
+		{
+			name:    "Header-less lines should be parsed with columns",
+			strCSV:  "2021-06-24T06:00:00.000Z,6892\n2021-06-24T07:00:00.000Z,7945",
+			dialect: Dialect{Columns: []string{"timestamp", "audience"}},
+			want: []map[string]interface{}{
+				{"timestamp": "2021-06-24T06:00:00.000Z", "audience": "6892"},
+				{"timestamp": "2021-06-24T07:00:00.000Z", "audience": "7945"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []map[string]interface{}{}
+			_, err := ParseDialect(context.Background(), strings.NewReader(tt.strCSV), tt.dialect, func(row map[string]interface{}) error {
+				got = append(got, row)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDialect() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				var pErr *csv.ParseError
+				if tt.wantLine != 0 && (!errors.As(err, &pErr) || pErr.Line != tt.wantLine) {
+					t.Errorf("ParseDialect() error = %v, want line %d", err, tt.wantLine)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDialect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ParseDialect_rowShape(t *testing.T) {
+	const ragged = `timestamp,publishing_point,audience
+2021-06-24T06:00:00.000Z,/foo_bar_00,6892
+2021-06-24T06:00:00.000Z,/foo_bar_01
+2021-06-24T06:00:00.000Z,/foo_bar_02,12157,foo
+2021-06-24T06:00:00.000Z,/foo_bar_03,2017`
+
+	tests := []struct {
+		name        string
+		shape       RowShape
+		strCSV      string
+		want        []map[string]interface{}
+		wantSkipped int
+		wantErr     *FieldCountError
+	}{
+		{
+			name:    "Short rows should return an error by default",
+			strCSV:  ragged,
+			wantErr: &FieldCountError{Line: 3, Column: "audience", Fields: 2, Expected: 3},
+		},
+		{
+			name:    "Long rows should return an error when strict",
+			shape:   RowShapeStrict,
+			strCSV:  "timestamp,audience\n2021-06-24T06:00:00.000Z,6892,foo",
+			wantErr: &FieldCountError{Line: 2, Fields: 3, Expected: 2},
+		},
+		{
+			name:    "Long rows should return an error when padding",
+			shape:   RowShapePad,
+			strCSV:  ragged,
+			wantErr: &FieldCountError{Line: 4, Fields: 4, Expected: 3},
+		},
+		{
+			name:   "Short rows should be padded",
+			shape:  RowShapePad,
+			strCSV: "timestamp,publishing_point,audience\n2021-06-24T06:00:00.000Z,/foo_bar_01",
+			want: []map[string]interface{}{
+				{"timestamp": "2021-06-24T06:00:00.000Z", "publishing_point": "/foo_bar_01", "audience": ""},
+			},
+		},
+		{
+			name:   "Ragged rows should be truncated or padded",
+			shape:  RowShapeTruncate,
+			strCSV: ragged,
+			want: []map[string]interface{}{
+				{"timestamp": "2021-06-24T06:00:00.000Z", "publishing_point": "/foo_bar_00", "audience": "6892"},
+				{"timestamp": "2021-06-24T06:00:00.000Z", "publishing_point": "/foo_bar_01", "audience": ""},
+				{"timestamp": "2021-06-24T06:00:00.000Z", "publishing_point": "/foo_bar_02", "audience": "12157"},
+				{"timestamp": "2021-06-24T06:00:00.000Z", "publishing_point": "/foo_bar_03", "audience": "2017"},
+			},
+		},
+		{
+			name:   "Ragged rows should be skipped and counted",
+			shape:  RowShapeSkip,
+			strCSV: ragged,
+			want: []map[string]interface{}{
+				{"timestamp": "2021-06-24T06:00:00.000Z", "publishing_point": "/foo_bar_00", "audience": "6892"},
+				{"timestamp": "2021-06-24T06:00:00.000Z", "publishing_point": "/foo_bar_03", "audience": "2017"},
+			},
+			wantSkipped: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []map[string]interface{}{}
+			skipped, err := ParseDialect(context.Background(), strings.NewReader(tt.strCSV), Dialect{RowShape: tt.shape}, func(row map[string]interface{}) error {
+				got = append(got, row)
+				return nil
+			})
+			if tt.wantErr != nil {
+				var fcErr *FieldCountError
+				if !errors.As(err, &fcErr) || !reflect.DeepEqual(fcErr, tt.wantErr) {
+					t.Errorf("ParseDialect() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDialect() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDialect() = %v, want %v", got, tt.want)
+			}
+			if skipped != tt.wantSkipped {
+				t.Errorf("ParseDialect() skipped = %d, want %d", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestReader_Header(t *testing.T) {
+	tests := []struct {
+		name    string
+		strCSV  string
+		dialect Dialect
+		want    []string
+		wantRow map[string]interface{}
+		wantErr *DuplicateColumnError
+	}{
+		{
+			name:    "Header fields should be trimmed",
+			strCSV:  "\xEF\xBB\xBF\"timestamp\", audience \n2021-06-24T06:00:00.000Z,6892",
+			want:    []string{"timestamp", "audience"},
+			wantRow: map[string]interface{}{"timestamp": "2021-06-24T06:00:00.000Z", "audience": "6892"},
+		},
+		{
+			name:    "Header fields should be lower cased",
+			strCSV:  "Timestamp,Publishing Point\n2021-06-24T06:00:00.000Z,/foo_bar_00",
+			dialect: Dialect{HeaderCase: HeaderCaseLower},
+			want:    []string{"timestamp", "publishing point"},
+			wantRow: map[string]interface{}{"timestamp": "2021-06-24T06:00:00.000Z", "publishing point": "/foo_bar_00"},
+		},
+		{
+			name:    "Header fields should be snake cased",
+			strCSV:  "Timestamp,Publishing Point,audienceCount,HTTPStatus,bit-rate (kbps)\n2021-06-24T06:00:00.000Z,/foo_bar_00,6892,200,3000",
+			dialect: Dialect{HeaderCase: HeaderCaseSnake},
+			want:    []string{"timestamp", "publishing_point", "audience_count", "http_status", "bit_rate_kbps"},
+			wantRow: map[string]interface{}{
+				"timestamp":        "2021-06-24T06:00:00.000Z",
+				"publishing_point": "/foo_bar_00",
+				"audience_count":   "6892",
+				"http_status":      "200",
+				"bit_rate_kbps":    "3000",
+			},
+		},
+		{
+			name:    "Duplicate columns should be suffixed by default",
+			strCSV:  "timestamp,audience,audience,audience_2,audience\n2021-06-24T06:00:00.000Z,1,2,3,4",
+			want:    []string{"timestamp", "audience", "audience_3", "audience_2", "audience_4"},
+			wantRow: map[string]interface{}{"timestamp": "2021-06-24T06:00:00.000Z", "audience": "1", "audience_3": "2", "audience_2": "3", "audience_4": "4"},
+		},
+		{
+			name:    "Duplicate columns after normalization should keep the first",
+			strCSV:  "timestamp,Audience,audience \n2021-06-24T06:00:00.000Z,1,2",
+			dialect: Dialect{HeaderCase: HeaderCaseLower, DuplicateColumns: DuplicateColumnsFirst},
+			want:    []string{"timestamp", "audience"},
+			wantRow: map[string]interface{}{"timestamp": "2021-06-24T06:00:00.000Z", "audience": "1"},
+		},
+		{
+			name:    "Duplicate columns should return an error",
+			strCSV:  "# export\ntimestamp,audience,audience\n2021-06-24T06:00:00.000Z,1,2",
+			dialect: Dialect{Comment: '#', DuplicateColumns: DuplicateColumnsFail},
+			wantErr: &DuplicateColumnError{Line: 2, Column: "audience"},
+		},
+		{
+			name:    "Empty header fields should be ignored",
+			strCSV:  "timestamp,,audience\n2021-06-24T06:00:00.000Z,foo,1",
+			want:    []string{"timestamp", "audience"},
+			wantRow: map[string]interface{}{"timestamp": "2021-06-24T06:00:00.000Z", "audience": "1"},
+		},
+		{
+			name:    "Columns should be normalized",
+			strCSV:  "\xEF\xBB\xBF2021-06-24T06:00:00.000Z,1",
+			dialect: Dialect{Columns: []string{"Timestamp", "Audience"}, HeaderCase: HeaderCaseSnake},
+			want:    []string{"timestamp", "audience"},
+			wantRow: map[string]interface{}{"timestamp": "2021-06-24T06:00:00.000Z", "audience": "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tt.strCSV), tt.dialect)
+			got, err := r.Header()
+			if tt.wantErr != nil {
+				var dErr *DuplicateColumnError
+				if !errors.As(err, &dErr) || !reflect.DeepEqual(dErr, tt.wantErr) {
+					t.Errorf("Header() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Header() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Header() = %q, want %q", got, tt.want)
+			}
+			row, err := r.Read(context.Background())
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if !reflect.DeepEqual(row, tt.wantRow) {
+				t.Errorf("Read() = %v, want %v", row, tt.wantRow)
+			}
+		})
+	}
+}
+
+func TestDialect_HeaderNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  []string
+		dialect Dialect
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "Duplicate names should be suffixed by default",
+			fields: []string{"timestamp", "audience", "audience"},
+			want:   []string{"timestamp", "audience", "audience_2"},
+		},
+		{
+			name:    "Names should be cased",
+			fields:  []string{"Timestamp", "Publishing Point"},
+			dialect: Dialect{HeaderCase: HeaderCaseSnake},
+			want:    []string{"timestamp", "publishing_point"},
+		},
+		{
+			name:    "Ignored columns should have empty names",
+			fields:  []string{"timestamp", "", "Audience", "audience"},
+			dialect: Dialect{HeaderCase: HeaderCaseLower, DuplicateColumns: DuplicateColumnsFirst},
+			want:    []string{"timestamp", "", "audience", ""},
+		},
+		{
+			name:    "Duplicate names should return an error",
+			fields:  []string{"audience", "audience"},
+			dialect: Dialect{DuplicateColumns: DuplicateColumnsFail},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.dialect.HeaderNames(tt.fields)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HeaderNames() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("HeaderNames() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
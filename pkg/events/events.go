@@ -0,0 +1,175 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+	"github.com/rs/zerolog/log"
+)
+
+// Client is the subset of the SQS API used to consume notifications,
+// it is implemented by *sqs.Client
+type Client interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// Consumer describes what an S3 event notifications consumer should do
+type Consumer interface {
+	// Consume receives a batch of messages and calls fn for each object
+	// created they notify. A message is deleted only once fn succeeded
+	// for all its objects, otherwise it will be received again once its
+	// visibility timeout expires.
+	Consume(ctx context.Context, fn func(ctx context.Context, o store.Object) error) error
+}
+
+// consumer is the Consumer implementation
+type consumer struct {
+	cli               Client
+	queueURL          string
+	bucket            string
+	waitTime          time.Duration
+	visibilityTimeout time.Duration
+}
+
+// NewConsumer returns a Consumer implementation from given parameters.
+// Only notifications for given bucket are considered, unless it is empty.
+func NewConsumer(cli Client, queueURL, bucket string, waitTime, visibilityTimeout time.Duration) Consumer {
+	return &consumer{
+		cli:               cli,
+		queueURL:          queueURL,
+		bucket:            bucket,
+		waitTime:          waitTime,
+		visibilityTimeout: visibilityTimeout,
+	}
+}
+
+// Consume is the Consumer Consume implementation
+func (c *consumer) Consume(ctx context.Context, fn func(ctx context.Context, o store.Object) error) error {
+	out, err := c.cli.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(c.queueURL),
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     int32(c.waitTime.Seconds()),
+		VisibilityTimeout:   int32(c.visibilityTimeout.Seconds()),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Messages are handled concurrently, a failing message does not
+	// prevent the others from being deleted
+	var wg sync.WaitGroup
+	wg.Add(len(out.Messages))
+	for _, item := range out.Messages {
+		m := item
+		go func() {
+			defer wg.Done()
+			c.handle(ctx, m, fn)
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// handle calls fn for all objects of given message and deletes it if
+// they were all successfully handled
+func (c *consumer) handle(ctx context.Context, m types.Message, fn func(ctx context.Context, o store.Object) error) {
+	objs, err := c.parseObjects(aws.ToString(m.Body))
+	if err != nil {
+		log.Error().
+			Err(err).
+			Str("message", aws.ToString(m.MessageId)).
+			Msg("Failed to parse S3 event notification")
+		return
+	}
+
+	for _, o := range objs {
+		if err := fn(ctx, o); err != nil {
+			log.Error().
+				Err(err).
+				Str("message", aws.ToString(m.MessageId)).
+				Str("object", o.Key).
+				Msg("Failed to handle S3 event notification")
+			return
+		}
+	}
+
+	if _, err := c.cli.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(c.queueURL),
+		ReceiptHandle: m.ReceiptHandle,
+	}); err != nil {
+		log.Error().
+			Err(err).
+			Str("message", aws.ToString(m.MessageId)).
+			Msg("Failed to delete message")
+	}
+}
+
+// notification is an S3 event notification, possibly wrapped in an SNS
+// notification
+type notification struct {
+	Records []record `json:"Records"`
+
+	// SNS envelope fields
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// record is an S3 event notification record
+type record struct {
+	EventName string    `json:"eventName"`
+	EventTime time.Time `json:"eventTime"`
+	S3        struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			Key  string `json:"key"`
+			Size int64  `json:"size"`
+			ETag string `json:"eTag"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// parseObjects returns the objects created notified in given message body.
+// Other events (removals, test events...) are ignored.
+func (c *consumer) parseObjects(body string) ([]store.Object, error) {
+	var n notification
+	if err := json.Unmarshal([]byte(body), &n); err != nil {
+		return nil, err
+	}
+	if n.Type == "Notification" && n.Message != "" {
+		return c.parseObjects(n.Message)
+	}
+
+	res := []store.Object{}
+	for _, r := range n.Records {
+		if !strings.HasPrefix(r.EventName, "ObjectCreated:") {
+			continue
+		}
+		if c.bucket != "" && r.S3.Bucket.Name != c.bucket {
+			continue
+		}
+		// Keys are URL encoded in notifications
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, store.Object{
+			Key:          key,
+			LastModified: r.EventTime,
+			Size:         r.S3.Object.Size,
+			ETag:         r.S3.Object.ETag,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,144 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+)
+
+// fakeClient is an in memory Client implementation
+type fakeClient struct {
+	mu       sync.Mutex
+	messages []types.Message
+	deleted  []string
+}
+
+func (c *fakeClient) ReceiveMessage(_ context.Context, _ *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &sqs.ReceiveMessageOutput{Messages: c.messages}, nil
+}
+
+func (c *fakeClient) DeleteMessage(_ context.Context, params *sqs.DeleteMessageInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deleted = append(c.deleted, aws.ToString(params.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func message(id, body string) types.Message {
+	return types.Message{
+		MessageId:     aws.String(id),
+		ReceiptHandle: aws.String(id),
+		Body:          aws.String(body),
+	}
+}
+
+func Test_consumer_Consume(t *testing.T) {
+	errFail := errors.New("fail")
+	tests := []struct {
+		name        string
+		messages    []types.Message
+		failKey     string
+		wantKeys    []string
+		wantDeleted []string
+	}{
+		{
+			name: "Created objects should be handled and messages deleted",
+			messages: []types.Message{
+				message("1", `{"Records":[{"eventName":"ObjectCreated:Put","eventTime":"2021-06-24T06:00:00.000Z","s3":{"bucket":{"name":"foo"},"object":{"key":"bar/baz+qux.csv","size":12}}}]}`),
+				message("2", `{"Records":[{"eventName":"ObjectCreated:CompleteMultipartUpload","s3":{"bucket":{"name":"foo"},"object":{"key":"bar/quux.csv","size":12}}}]}`),
+			},
+			wantKeys:    []string{"bar/baz qux.csv", "bar/quux.csv"},
+			wantDeleted: []string{"1", "2"},
+		},
+		{
+			name: "Other events and buckets should be ignored",
+			messages: []types.Message{
+				message("1", `{"Records":[{"eventName":"ObjectRemoved:Delete","s3":{"bucket":{"name":"foo"},"object":{"key":"bar/baz.csv"}}}]}`),
+				message("2", `{"Records":[{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"bar"},"object":{"key":"bar/baz.csv"}}}]}`),
+				message("3", `{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"foo"}`),
+			},
+			wantKeys:    []string{},
+			wantDeleted: []string{"1", "2", "3"},
+		},
+		{
+			name: "SNS wrapped notifications should be handled",
+			messages: []types.Message{
+				message("1", `{"Type":"Notification","Message":"{\"Records\":[{\"eventName\":\"ObjectCreated:Put\",\"s3\":{\"bucket\":{\"name\":\"foo\"},\"object\":{\"key\":\"bar/baz.csv\"}}}]}"}`),
+			},
+			wantKeys:    []string{"bar/baz.csv"},
+			wantDeleted: []string{"1"},
+		},
+		{
+			name: "Failed or invalid messages should not be deleted",
+			messages: []types.Message{
+				message("1", `{"Records":[{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"foo"},"object":{"key":"bar/fail.csv"}}}]}`),
+				message("2", `foo`),
+				message("3", `{"Records":[{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"foo"},"object":{"key":"bar/baz.csv"}}}]}`),
+			},
+			failKey:     "bar/fail.csv",
+			wantKeys:    []string{"bar/baz.csv", "bar/fail.csv"},
+			wantDeleted: []string{"3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := &fakeClient{messages: tt.messages}
+			c := NewConsumer(cli, "queue", "foo", time.Second, time.Minute)
+
+			var mu sync.Mutex
+			keys := []string{}
+			err := c.Consume(context.Background(), func(_ context.Context, o store.Object) error {
+				mu.Lock()
+				defer mu.Unlock()
+				keys = append(keys, o.Key)
+				if o.Key == tt.failKey {
+					return errFail
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("consumer.Consume() error = %v", err)
+			}
+
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("consumer.Consume() keys = %v, want %v", keys, tt.wantKeys)
+			}
+			sort.Strings(cli.deleted)
+			if cli.deleted == nil {
+				cli.deleted = []string{}
+			}
+			if !reflect.DeepEqual(cli.deleted, tt.wantDeleted) {
+				t.Errorf("consumer.Consume() deleted = %v, want %v", cli.deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func Test_consumer_parseObjects(t *testing.T) {
+	c := &consumer{bucket: "foo"}
+	got, err := c.parseObjects(`{"Records":[{"eventName":"ObjectCreated:Put","eventTime":"2021-06-24T06:00:00.000Z","s3":{"bucket":{"name":"foo"},"object":{"key":"bar/baz%3Dqux.csv","size":12,"eTag":"0123456789abcdef"}}}]}`)
+	if err != nil {
+		t.Fatalf("consumer.parseObjects() error = %v", err)
+	}
+	want := []store.Object{{
+		Key:          "bar/baz=qux.csv",
+		LastModified: time.Date(2021, 6, 24, 6, 0, 0, 0, time.UTC),
+		Size:         12,
+		ETag:         "0123456789abcdef",
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("consumer.parseObjects() = %v, want %v", got, want)
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jessevdk/go-flags"
+	"github.com/quortex/influxdb-athena-crawler/pkg/state"
 )
 
 // regexFlagMap is a regex used toi extract map types flags
@@ -99,12 +102,38 @@ const (
 	FieldTypeInteger FieldType = "int"
 	FieldTypeString  FieldType = "string"
 	FieldTypeBool    FieldType = "bool"
+	// FieldTypeAuto keeps the type of the decoded value, it is meant
+	// for typed input formats such as Parquet.
+	FieldTypeAuto FieldType = "auto"
 )
 
 // isValid returns if the FieldType is a valid one
 func (t FieldType) isValid() bool {
 	switch t {
-	case FieldTypeFloat, FieldTypeInteger, FieldTypeString, FieldTypeBool:
+	case FieldTypeFloat, FieldTypeInteger, FieldTypeString, FieldTypeBool, FieldTypeAuto:
+		return true
+	}
+	return false
+}
+
+// NullPolicy describes how null field values are handled
+type NullPolicy string
+
+// All null policies
+const (
+	// NullPolicyOmit writes points without the field
+	NullPolicyOmit NullPolicy = "omit"
+	// NullPolicyDefault writes the field default value instead
+	NullPolicyDefault NullPolicy = "default"
+	// NullPolicyReject rejects the row, it is not written
+	NullPolicyReject NullPolicy = "reject"
+)
+
+// isValid returns if the NullPolicy is a valid one, the empty one being
+// the default omit one
+func (p NullPolicy) isValid() bool {
+	switch p {
+	case "", NullPolicyOmit, NullPolicyDefault, NullPolicyReject:
 		return true
 	}
 	return false
@@ -114,6 +143,11 @@ func (t FieldType) isValid() bool {
 type Field struct {
 	Field, Row string
 	FieldType  FieldType
+	// Null is how null values are handled, they are omitted if empty
+	Null NullPolicy
+	// Default is the value written instead of null values with the
+	// default null policy
+	Default string
 }
 
 // UnmarshalFlag is the go-flags Value UnmarshalFlag implementation for Field
@@ -134,9 +168,27 @@ func (f *Field) UnmarshalFlag(arg string) error {
 		return fmt.Errorf("%q invalid field type", arg)
 	}
 
+	// A default value implies the default null policy
+	def, hasDefault := fm.v["default"]
+	null := NullPolicy(fm.v["null"])
+	if null == "" && hasDefault {
+		null = NullPolicyDefault
+	}
+	if !null.isValid() {
+		return fmt.Errorf("%q invalid null policy", arg)
+	}
+	if null == NullPolicyDefault && !validDefault(def, hasDefault, fType) {
+		return fmt.Errorf("%q invalid default value", arg)
+	}
+	if null != NullPolicyDefault && hasDefault {
+		return fmt.Errorf("%q default value requires the default null policy", arg)
+	}
+
 	f.Field = field
 	f.Row = row
 	f.FieldType = fType
+	f.Null = null
+	f.Default = def
 	return nil
 }
 
@@ -149,35 +201,368 @@ func (f *Field) MarshalFlag() (string, error) {
 	if f.Row != "" {
 		m.v["row"] = f.Row
 	}
+	if f.Null != "" {
+		m.v["null"] = string(f.Null)
+	}
+	if f.Null == NullPolicyDefault {
+		m.v["default"] = f.Default
+	}
 
 	return m.marshalFlag()
 }
 
+// validDefault returns whether given default value, if any, can be
+// written as a field of given type
+func validDefault(def string, ok bool, fType FieldType) bool {
+	if !ok {
+		return false
+	}
+	var err error
+	switch fType {
+	case FieldTypeFloat:
+		_, err = strconv.ParseFloat(def, 64)
+	case FieldTypeInteger:
+		_, err = strconv.Atoi(def)
+	case FieldTypeBool:
+		_, err = strconv.ParseBool(def)
+	}
+	return err == nil
+}
+
+// regexPatternPrefix is the prefix of Pattern flags holding a regular
+// expression instead of a glob
+const regexPatternPrefix = "re:"
+
+// Pattern describes an object key pattern flag, either a glob or a
+// regular expression when prefixed with "re:".
+// In globs, * matches any sequence of characters but /, ** matches any
+// sequence of characters and ? matches any character but /.
+type Pattern struct {
+	raw string
+	re  *regexp.Regexp
+}
+
+// UnmarshalFlag is the go-flags Value UnmarshalFlag implementation for Pattern
+func (p *Pattern) UnmarshalFlag(arg string) error {
+	expr := strings.TrimPrefix(arg, regexPatternPrefix)
+	if expr == arg {
+		expr = globToRegexp(arg)
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("%q failed to parse: %w", arg, err)
+	}
+	p.raw = arg
+	p.re = re
+	return nil
+}
+
+// MarshalFlag is the go-flags Value MarshalFlag implementation for Pattern
+func (p *Pattern) MarshalFlag() (string, error) {
+	return p.raw, nil
+}
+
+// Match returns whether given key matches the pattern
+func (p *Pattern) Match(key string) bool {
+	return p.re != nil && p.re.MatchString(key)
+}
+
+// globToRegexp converts a glob to an anchored regular expression
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// sizeUnits are the units Size flags can be suffixed with
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{suffix: "KiB", bytes: 1 << 10},
+	{suffix: "MiB", bytes: 1 << 20},
+	{suffix: "GiB", bytes: 1 << 30},
+	{suffix: "KB", bytes: 1e3},
+	{suffix: "MB", bytes: 1e6},
+	{suffix: "GB", bytes: 1e9},
+	{suffix: "B", bytes: 1},
+}
+
+// Size describes a size in bytes flag, either a number of bytes or a
+// number suffixed with a unit (e.g. 8MiB or 10MB)
+type Size int64
+
+// UnmarshalFlag is the go-flags Value UnmarshalFlag implementation for Size
+func (s *Size) UnmarshalFlag(arg string) error {
+	num, mult := arg, int64(1)
+	for _, u := range sizeUnits {
+		if n, ok := strings.CutSuffix(arg, u.suffix); ok {
+			num, mult = n, u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(num), 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%q is not a valid size, expected a number of bytes optionally suffixed with KiB, MiB, GiB, KB, MB or GB", arg)
+	}
+	*s = Size(n * mult)
+	return nil
+}
+
+// MarshalFlag is the go-flags Value MarshalFlag implementation for Size
+func (s Size) MarshalFlag() (string, error) {
+	return strconv.FormatInt(int64(s), 10), nil
+}
+
+// Char describes a single character flag, tabs can be given as \t
+type Char rune
+
+// UnmarshalFlag is the go-flags Value UnmarshalFlag implementation for Char
+func (c *Char) UnmarshalFlag(arg string) error {
+	if arg == `\t` {
+		*c = '\t'
+		return nil
+	}
+	r := []rune(arg)
+	if len(r) != 1 {
+		return fmt.Errorf("%q is not a single character", arg)
+	}
+	*c = Char(r[0])
+	return nil
+}
+
+// MarshalFlag is the go-flags Value MarshalFlag implementation for Char
+func (c Char) MarshalFlag() (string, error) {
+	if c == 0 {
+		return "", nil
+	}
+	if c == '\t' {
+		return `\t`, nil
+	}
+	return string(c), nil
+}
+
+// Format describes an input objects format
+type Format string
+
+// All input objects formats
+const (
+	// FormatAuto detects format from object key
+	FormatAuto    Format = "auto"
+	FormatCSV     Format = "csv"
+	FormatParquet Format = "parquet"
+	FormatJSONL   Format = "jsonl"
+)
+
+// StateStore describes where processing states are stored
+type StateStore string
+
+// All processing state stores
+const (
+	// StateStoreMarkers writes marker objects next to data objects
+	StateStoreMarkers  StateStore = "markers"
+	StateStoreTagging  StateStore = "tagging"
+	StateStoreFile     StateStore = "file"
+	StateStoreDynamoDB StateStore = "dynamodb"
+)
+
 // Options wraps all flags
 type Options struct {
-	Region              string        `long:"region" description:"The AWS region." required:"true"`
-	Bucket              string        `long:"bucket" description:"The AWS bucket to watch." required:"true"`
-	Prefix              string        `long:"prefix" description:"The bucket prefix."`
-	Suffix              string        `long:"suffix" description:"Filename suffix to limit files read on the bucket."`
-	ProcessedFlagSuffix string        `long:"processed-flag-suffix" description:"Filename suffix to mark csv files as processed on the bucket." default:"processed"`
-	CleanObjects        bool          `long:"clean-objects" description:"Whether to delete S3 objects after processing them."`
-	MaxObjectAge        time.Duration `long:"max-object-age" description:"When cleanup is activated, only trigger deletion if csv is at least this old." default:"10m"`
-	Timeout             time.Duration `long:"timeout" description:"The global timeout." default:"30s"`
-	InfluxServers       []string      `long:"influx-server" description:"The InfluxDB servers addresses." required:"true"`
-	InfluxToken         string        `long:"influx-token" description:"The InfluxDB token." required:"true"`
-	InfluxOrg           string        `long:"influx-org" description:"The InfluxDB org to write to." required:"true"`
-	InfluxBucket        string        `long:"influx-bucket" description:"The InfluxDB bucket write to." required:"true"`
-	Measurement         string        `long:"measurement" description:"A measurement acts as a container for tags, fields, and timestamps. Use a measurement name that describes your data." required:"true"`
-	TimestampRow        string        `long:"timestamp-row" description:"The timestamp row in CSV." default:"timestamp"`
-	TimestampLayout     string        `long:"timestamp-layout" description:"The layout to parse timestamp." default:"2006-01-02T15:04:05.000Z"`
-	Tags                []*Tag        `long:"tag" description:"Tags to add to InfluxDB point. Could be of the form --tag=foo if tag name matches CSV row or --tag='foo={row:bar}' to specify row."`
-	Fields              []*Field      `long:"field" description:"Fields to add to InfluxDB point. Could be of the form --field='foo={type:int,row:bar}', if not specified, CSV row matches field name. Type can be float, int, string or bool."`
-	MaxRoutines         int           `long:"max-routines" description:"How many routines should be created to parallelize object processing." default:"100"`
+	Region                   string        `long:"region" description:"The AWS region."`
+	RoleARN                  string        `long:"role-arn" description:"An IAM role to assume to access the crawled bucket and the Athena / SQS APIs, credentials are refreshed automatically."`
+	RoleExternalID           string        `long:"role-external-id" description:"The external ID required to assume the role, if any."`
+	RoleSessionName          string        `long:"role-session-name" description:"The session name of assumed roles." default:"influxdb-athena-crawler"`
+	StateRoleARN             string        `long:"state-role-arn" description:"An IAM role to assume to access the DynamoDB state store and the archive bucket, the role-arn one (or the default credentials) is used if not set."`
+	StateRoleExternalID      string        `long:"state-role-external-id" description:"The external ID required to assume the state role, if any."`
+	Bucket                   string        `long:"bucket" description:"The AWS bucket to watch."`
+	LocalDir                 string        `long:"local-dir" description:"A local directory to watch instead of an AWS bucket."`
+	S3EndpointURL            string        `long:"s3-endpoint-url" description:"A custom S3 endpoint URL, e.g. an S3 compatible service such as MinIO or Ceph."`
+	S3ForcePathStyle         bool          `long:"s3-force-path-style" description:"Address buckets in the URL path rather than as a virtual host, usually required by S3 compatible services."`
+	S3DisableSSL             bool          `long:"s3-disable-ssl" description:"Use HTTP rather than HTTPS for S3 endpoints resolved from the region."`
+	S3CABundle               string        `long:"s3-ca-bundle" description:"A PEM file of certificate authorities to trust in addition to the system ones for S3 requests."`
+	S3RequesterPays          bool          `long:"s3-requester-pays" description:"Acknowledge that S3 requests to requester pays buckets are charged to the crawler account."`
+	Prefixes                 []string      `long:"prefix" description:"The bucket prefix, can be repeated to crawl several prefixes. Prefixes can be templates, see prefix-lookback."`
+	PrefixLookback           time.Duration `long:"prefix-lookback" description:"How far back to expand prefix templates (e.g. --prefix='reports/dt={{.Date \"2006-01-02\"}}/'), prefixes are expanded for each prefix-step of this window ending now."`
+	PrefixStep               time.Duration `long:"prefix-step" description:"The partitions granularity prefix templates are expanded with over the lookback window, e.g. 1h for hourly partitions." default:"24h"`
+	Includes                 []*Pattern    `long:"include" description:"Only process objects whose key matches this pattern, can be repeated. Patterns are globs (* does not match /, ** does) unless prefixed with re: for regular expressions."`
+	Excludes                 []*Pattern    `long:"exclude" description:"Do not process objects whose key matches this pattern, can be repeated. Patterns are globs (* does not match /, ** does) unless prefixed with re: for regular expressions."`
+	Suffix                   string        `long:"suffix" description:"Filename suffix to limit files read on the bucket."`
+	ProcessedFlagSuffix      string        `long:"processed-flag-suffix" description:"Filename suffix to mark csv files as processed on the bucket." default:"processed"`
+	StateStore               StateStore    `long:"state-store" description:"Where to store processing states: markers objects next to data objects, S3 tags of data objects, a local file or a DynamoDB table." choice:"markers" choice:"tagging" choice:"file" choice:"dynamodb" default:"markers"`
+	StateFile                string        `long:"state-file" description:"The local file holding processing states with the file state store."`
+	StateDynamoDBTable       string        `long:"state-dynamodb-table" description:"The DynamoDB table holding processing states with the dynamodb state store, its partition key must be a string named object_key."`
+	StateDynamoDBEndpointURL string        `long:"state-dynamodb-endpoint-url" description:"A custom DynamoDB endpoint URL, e.g. a local DynamoDB compatible service."`
+	DeleteBeforeRewrite      bool          `long:"delete-before-rewrite" description:"When an object changed since its processing, delete the points previously written from it (selected by the source tag) between their min and max timestamps from InfluxDB before writing it again. Requires --source-tag, not supported by the tagging state store."`
+	SourceTag                string        `long:"source-tag" description:"A tag holding the key of the object points are read from, e.g. source. It adds a series per object."`
+	CleanObjects             bool          `long:"clean-objects" description:"Whether to delete S3 objects after processing them."`
+	MaxObjectAge             time.Duration `long:"max-object-age" description:"When cleanup is activated, only trigger deletion if csv is at least this old." default:"10m"`
+	ArchivePrefix            string        `long:"archive-prefix" description:"When cleanup is activated, copy objects under this prefix (of the archive bucket) before deleting them, keeping their key."`
+	ArchiveBucket            string        `long:"archive-bucket" description:"When cleanup is activated, copy objects to this bucket before deleting them, the crawled bucket is used if not set."`
+	ArchiveStorageClass      string        `long:"archive-storage-class" description:"The storage class of archived objects (e.g. GLACIER_IR), the archive bucket default one is used if not set."`
+	QuarantinePrefix         string        `long:"quarantine-prefix" description:"Move objects which cannot be parsed or converted to points under this prefix, keeping their key, along with an error sidecar JSON, instead of failing the run."`
+	Timeout                  time.Duration `long:"timeout" description:"The global timeout, or the timeout to process each object when consuming SQS events." default:"30s"`
+	InfluxServers            []string      `long:"influx-server" description:"The InfluxDB servers addresses." required:"true"`
+	InfluxToken              string        `long:"influx-token" description:"The InfluxDB token." required:"true"`
+	InfluxOrg                string        `long:"influx-org" description:"The InfluxDB org to write to." required:"true"`
+	InfluxBucket             string        `long:"influx-bucket" description:"The InfluxDB bucket write to." required:"true"`
+	Measurement              string        `long:"measurement" description:"A measurement acts as a container for tags, fields, and timestamps. Use a measurement name that describes your data." required:"true"`
+	TimestampRow             string        `long:"timestamp-row" description:"The timestamp row in CSV." default:"timestamp"`
+	TimestampLayout          string        `long:"timestamp-layout" description:"The layout to parse timestamp." default:"2006-01-02T15:04:05.000Z"`
+	Tags                     []*Tag        `long:"tag" description:"Tags to add to InfluxDB point. Could be of the form --tag=foo if tag name matches CSV row or --tag='foo={row:bar}' to specify row."`
+	Fields                   []*Field      `long:"field" description:"Fields to add to InfluxDB point. Could be of the form --field='foo={type:int,row:bar}', if not specified, CSV row matches field name. Type can be float, int, string, bool or auto to keep the type of typed formats. Null values are omitted unless null is default (e.g. --field='foo={type:int,default:0}') or reject to reject the row."`
+	InferFields              bool          `long:"infer-fields" description:"Infer fields and their types from the Athena .metadata file of each CSV object, --field flags take precedence over inferred fields."`
+	Format                   Format        `long:"format" description:"The objects format, auto detects it from the object key (.parquet, .json / .jsonl / .ndjson or csv otherwise)." choice:"auto" choice:"csv" choice:"parquet" choice:"jsonl" default:"auto"`
+	CSVDelimiter             Char          `long:"csv-delimiter" description:"The CSV fields delimiter, e.g. ';', '|' or '\\t' for TSV." default:","`
+	CSVLazyQuotes            bool          `long:"csv-lazy-quotes" description:"Allow quotes in unquoted CSV fields and non doubled quotes in quoted fields."`
+	CSVComment               Char          `long:"csv-comment" description:"The character starting CSV comment lines, which are ignored, e.g. '#'."`
+	CSVSkipLeadingLines      int           `long:"csv-skip-leading-lines" description:"How many lines to ignore at the beginning of CSV objects, before the header."`
+	CSVSkipTrailingLines     int           `long:"csv-skip-trailing-lines" description:"How many lines to ignore at the end of CSV objects."`
+	CSVColumns               []string      `long:"csv-column" description:"The columns of header-less CSV objects, in order, can be repeated. CSV objects first line holds them if not set."`
+	CSVRaggedRows            string        `long:"csv-ragged-rows" description:"How to handle CSV rows whose fields count differs from the header one: fail, pad missing fields with empty values, also truncate extra fields, or skip them." choice:"strict" choice:"pad" choice:"truncate" choice:"skip" default:"strict"`
+	CSVHeaderCase            string        `long:"csv-header-case" description:"How to case CSV header fields, which are always trimmed: keep them as is, lower case them or convert them to snake_case. Tags, fields and timestamp rows refer to the resulting fields." choice:"keep" choice:"lower" choice:"snake" default:"keep"`
+	CSVDuplicateColumns      string        `long:"csv-duplicate-columns" description:"How to handle CSV columns whose (cased) field is already taken: suffix them with an index (e.g. foo_2), fail or keep the first one." choice:"suffix" choice:"fail" choice:"first" default:"suffix"`
+	NullTokens               []string      `long:"null-token" description:"A value standing for null in objects, can be repeated (e.g. --null-token='' --null-token=NULL --null-token='\\N' --null-token=NaN). Null fields are handled according to their null policy, null tags are omitted." default:""`
+	SQSQueueURL              string        `long:"sqs-queue-url" description:"An SQS queue receiving S3 event notifications. If set, the crawler runs until interrupted and only processes notified objects instead of listing the prefix."`
+	SQSEndpointURL           string        `long:"sqs-endpoint-url" description:"A custom SQS endpoint URL, e.g. a local SQS compatible service."`
+	SQSWaitTime              time.Duration `long:"sqs-wait-time" description:"How long to wait for SQS messages on each receive (long polling, 20s max)." default:"20s"`
+	SQSVisibilityTimeout     time.Duration `long:"sqs-visibility-timeout" description:"How long received SQS messages are hidden from other consumers, the queue setting is used if not set."`
+	AthenaQuery              string        `long:"athena-query" description:"An SQL statement to run with Athena, the crawler then ingests its result instead of listing the prefix."`
+	AthenaNamedQueryID       string        `long:"athena-named-query-id" description:"The ID of an Athena named query to run, the crawler then ingests its result instead of listing the prefix."`
+	AthenaDatabase           string        `long:"athena-database" description:"The Athena database to run the query in, the named query one is used if not set."`
+	AthenaWorkGroup          string        `long:"athena-workgroup" description:"The Athena workgroup to run the query in, the named query one (or primary) is used if not set."`
+	AthenaOutputLocation     string        `long:"athena-output-location" description:"The S3 location (s3://bucket/prefix/) to write the query result to, the workgroup one is used if not set."`
+	AthenaPollInterval       time.Duration `long:"athena-poll-interval" description:"How often to poll the Athena query execution status." default:"1s"`
+	DownloadPartSize         Size          `long:"download-part-size" description:"The size of the ranges S3 objects larger than it are downloaded by when download-concurrency is above 1 (e.g. 8MiB)." default:"8MiB"`
+	DownloadConcurrency      int           `long:"download-concurrency" description:"How many parts of each S3 object are downloaded at once, objects are streamed with a single request if 1." default:"1"`
+	DownloadMaxConnections   int           `long:"download-max-connections" description:"How many S3 download requests can be in flight across all objects, unlimited if 0."`
+	DownloadMaxBandwidth     Size          `long:"download-max-bandwidth" description:"The S3 download bandwidth across all objects per second (e.g. 50MiB), unlimited if 0."`
+	MaxRoutines              int           `long:"max-routines" description:"How many routines should be created to parallelize object processing." default:"100"`
+	BatchSize                int           `long:"batch-size" description:"How many rows should be read from an object before writing them to InfluxDB." default:"5000"`
+}
+
+// validate checks consistency between parsed options
+func (o *Options) validate() error {
+	athenaMode := o.AthenaQuery != "" || o.AthenaNamedQueryID != ""
+	if o.AthenaQuery != "" && o.AthenaNamedQueryID != "" {
+		return fmt.Errorf("the flags '--athena-query' and '--athena-named-query-id' are mutually exclusive")
+	}
+	if athenaMode && o.SQSQueueURL != "" {
+		return fmt.Errorf("the flags '--athena-query' / '--athena-named-query-id' and '--sqs-queue-url' are mutually exclusive")
+	}
+	if athenaMode && o.Region == "" {
+		return fmt.Errorf("the flag '--region' is required with '--athena-query' / '--athena-named-query-id'")
+	}
+	if !athenaMode && o.LocalDir == "" && (o.Region == "" || o.Bucket == "") {
+		return fmt.Errorf("the flags '--region' and '--bucket' are required unless '--local-dir' is specified")
+	}
+	if o.SQSQueueURL != "" && o.Region == "" {
+		return fmt.Errorf("the flag '--region' is required with '--sqs-queue-url'")
+	}
+	if o.RoleExternalID != "" && o.RoleARN == "" {
+		return fmt.Errorf("the flag '--role-external-id' requires '--role-arn'")
+	}
+	if o.StateRoleExternalID != "" && o.StateRoleARN == "" {
+		return fmt.Errorf("the flag '--state-role-external-id' requires '--state-role-arn'")
+	}
+	if o.StateRoleARN != "" && o.StateStore != StateStoreDynamoDB && (o.ArchiveBucket == "" || o.ArchiveBucket == o.Bucket) {
+		return fmt.Errorf("the flag '--state-role-arn' requires '--state-store=dynamodb' or another '--archive-bucket'")
+	}
+	if o.LocalDir != "" && (o.S3EndpointURL != "" || o.S3ForcePathStyle || o.S3DisableSSL || o.S3CABundle != "" || o.S3RequesterPays) {
+		return fmt.Errorf("the '--s3-*' flags cannot be used with '--local-dir'")
+	}
+	if o.StateStore == StateStoreTagging && o.LocalDir != "" {
+		return fmt.Errorf("the flag '--state-store=tagging' cannot be used with '--local-dir'")
+	}
+	if _, ok := state.ServersTagValue(o.InfluxServers); o.StateStore == StateStoreTagging && len(o.InfluxServers) > 1 && !ok {
+		return fmt.Errorf("the '--influx-server' flags must fit an S3 tag value with '--state-store=tagging' (256 letters, digits, spaces and _ . : / = + - @ characters)")
+	}
+	if o.StateStore == StateStoreFile && o.StateFile == "" {
+		return fmt.Errorf("the flag '--state-file' is required with '--state-store=file'")
+	}
+	if o.StateStore == StateStoreDynamoDB && (o.StateDynamoDBTable == "" || o.Region == "") {
+		return fmt.Errorf("the flags '--state-dynamodb-table' and '--region' are required with '--state-store=dynamodb'")
+	}
+	if archive := o.ArchivePrefix != "" || o.ArchiveBucket != ""; archive && !o.CleanObjects {
+		return fmt.Errorf("the flag '--clean-objects' is required with '--archive-prefix' / '--archive-bucket'")
+	}
+	if archive := o.ArchivePrefix != "" || o.ArchiveBucket != ""; !archive && o.ArchiveStorageClass != "" {
+		return fmt.Errorf("the flag '--archive-storage-class' requires '--archive-prefix' / '--archive-bucket'")
+	}
+	if o.LocalDir != "" && (o.ArchiveBucket != "" || o.ArchiveStorageClass != "") {
+		return fmt.Errorf("the flags '--archive-bucket' and '--archive-storage-class' cannot be used with '--local-dir'")
+	}
+	if o.ArchivePrefix == "" && o.ArchiveBucket == o.Bucket && o.Bucket != "" {
+		return fmt.Errorf("the flag '--archive-prefix' is required to archive objects in the crawled bucket")
+	}
+	if o.SQSWaitTime > 20*time.Second {
+		return fmt.Errorf("the flag '--sqs-wait-time' cannot exceed 20s")
+	}
+	if o.PrefixStep <= 0 {
+		return fmt.Errorf("the flag '--prefix-step' must be strictly positive")
+	}
+	if o.DownloadConcurrency < 0 {
+		return fmt.Errorf("the flag '--download-concurrency' cannot be negative")
+	}
+	if o.DownloadConcurrency > 1 && o.DownloadPartSize <= 0 {
+		return fmt.Errorf("the flag '--download-part-size' must be strictly positive with '--download-concurrency' above 1")
+	}
+	if o.DownloadMaxConnections < 0 {
+		return fmt.Errorf("the flag '--download-max-connections' cannot be negative")
+	}
+	if !validCSVChar(o.CSVDelimiter) {
+		return fmt.Errorf("the flag '--csv-delimiter' cannot be a quote, a line break or a replacement character")
+	}
+	if o.CSVComment != 0 && (!validCSVChar(o.CSVComment) || o.CSVComment == o.CSVDelimiter) {
+		return fmt.Errorf("the flag '--csv-comment' cannot be the delimiter, a quote, a line break or a replacement character")
+	}
+	if o.CSVSkipLeadingLines < 0 || o.CSVSkipTrailingLines < 0 {
+		return fmt.Errorf("the flags '--csv-skip-leading-lines' and '--csv-skip-trailing-lines' cannot be negative")
+	}
+	if o.BatchSize <= 0 {
+		return fmt.Errorf("the flag '--batch-size' must be strictly positive")
+	}
+	if o.DeleteBeforeRewrite && o.SourceTag == "" {
+		return fmt.Errorf("the flag '--source-tag' is required with '--delete-before-rewrite'")
+	}
+	// Tags are cleared on overwrite and do not record timestamps
+	if o.DeleteBeforeRewrite && o.StateStore == StateStoreTagging {
+		return fmt.Errorf("the flag '--delete-before-rewrite' cannot be used with '--state-store=tagging'")
+	}
+	for _, t := range o.Tags {
+		if o.SourceTag != "" && t.Tag == o.SourceTag {
+			return fmt.Errorf("the flag '--source-tag' cannot be one of the '--tag' flags")
+		}
+	}
+	return nil
+}
+
+// validCSVChar returns whether given character can be a CSV delimiter or
+// comment character, the zero one being the default
+func validCSVChar(c Char) bool {
+	return c == 0 || (c != '"' && c != '\r' && c != '\n' && c != utf8.RuneError && utf8.ValidRune(rune(c)))
 }
 
 // Parse parses flags into give Option
 func Parse(opts *Options) error {
 	parser := flags.NewParser(opts, flags.Default)
-	_, err := parser.Parse()
-	return err
+	if _, err := parser.Parse(); err != nil {
+		return err
+	}
+	return opts.validate()
 }
@@ -3,6 +3,7 @@ package flags
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestTag_UnmarshalFlag(t *testing.T) {
@@ -134,6 +135,8 @@ func TestField_UnmarshalFlag(t *testing.T) {
 		Field     string
 		Row       string
 		FieldType FieldType
+		Null      NullPolicy
+		Default   string
 	}
 	type args struct {
 		arg string
@@ -192,6 +195,18 @@ func TestField_UnmarshalFlag(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Unmarshal flag with auto field type should return a properly formatted field",
+			fields: fields{
+				Field:     "foo",
+				Row:       "foo",
+				FieldType: FieldTypeAuto,
+			},
+			args: args{
+				arg: "foo={type:auto}",
+			},
+			wantErr: false,
+		},
 		{
 			name: "Unmarshal flag with with additional args should work as well",
 			fields: fields{
@@ -204,6 +219,65 @@ func TestField_UnmarshalFlag(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Unmarshal flag with null policy should return a properly formatted field",
+			fields: fields{
+				Field:     "foo",
+				Row:       "foo",
+				FieldType: FieldTypeInteger,
+				Null:      NullPolicyReject,
+			},
+			args: args{
+				arg: "foo={type:int,null:reject}",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Unmarshal flag with default value should return a field with the default null policy",
+			fields: fields{
+				Field:     "foo",
+				Row:       "foo",
+				FieldType: FieldTypeFloat,
+				Null:      NullPolicyDefault,
+				Default:   "-1.5",
+			},
+			args: args{
+				arg: "foo={type:float,default:-1.5}",
+			},
+			wantErr: false,
+		},
+		{
+			name:   "Unmarshal flag with invalid null policy should return an error",
+			fields: fields{},
+			args: args{
+				arg: "foo={type:int,null:bar}",
+			},
+			wantErr: true,
+		},
+		{
+			name:   "Unmarshal flag with default null policy without default value should return an error",
+			fields: fields{},
+			args: args{
+				arg: "foo={type:int,null:default}",
+			},
+			wantErr: true,
+		},
+		{
+			name:   "Unmarshal flag with default value of another type should return an error",
+			fields: fields{},
+			args: args{
+				arg: "foo={type:int,default:bar}",
+			},
+			wantErr: true,
+		},
+		{
+			name:   "Unmarshal flag with default value and another null policy should return an error",
+			fields: fields{},
+			args: args{
+				arg: "foo={type:int,null:omit,default:0}",
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -212,6 +286,8 @@ func TestField_UnmarshalFlag(t *testing.T) {
 				Field:     tt.fields.Field,
 				Row:       tt.fields.Row,
 				FieldType: tt.fields.FieldType,
+				Null:      tt.fields.Null,
+				Default:   tt.fields.Default,
 			}
 			if err := got.UnmarshalFlag(tt.args.arg); (err != nil) != tt.wantErr {
 				t.Errorf("Field.UnmarshalFlag() error = %v, wantErr %v", err, tt.wantErr)
@@ -228,6 +304,8 @@ func TestField_MarshalFlag(t *testing.T) {
 		Field     string
 		Row       string
 		FieldType FieldType
+		Null      NullPolicy
+		Default   string
 	}
 	tests := []struct {
 		name    string
@@ -268,6 +346,17 @@ func TestField_MarshalFlag(t *testing.T) {
 			want:    "foo={row:bar,type:int}",
 			wantErr: false,
 		},
+		{
+			name: "Marshal field with default value should return a properly formatted field",
+			fields: fields{
+				Field:     "foo",
+				FieldType: FieldTypeInteger,
+				Null:      NullPolicyDefault,
+				Default:   "0",
+			},
+			want:    "foo={default:0,null:default,type:int}",
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -275,6 +364,8 @@ func TestField_MarshalFlag(t *testing.T) {
 				Field:     tt.fields.Field,
 				Row:       tt.fields.Row,
 				FieldType: tt.fields.FieldType,
+				Null:      tt.fields.Null,
+				Default:   tt.fields.Default,
 			}
 			got, err := f.MarshalFlag()
 			if (err != nil) != tt.wantErr {
@@ -287,3 +378,368 @@ func TestField_MarshalFlag(t *testing.T) {
 		})
 	}
 }
+
+func TestOptions_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{
+			name:    "Missing bucket and local directory should return an error",
+			opts:    Options{Region: "eu-west-1", BatchSize: 1, PrefixStep: time.Hour},
+			wantErr: true,
+		},
+		{
+			name:    "Missing region and local directory should return an error",
+			opts:    Options{Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour},
+			wantErr: true,
+		},
+		{
+			name:    "Region and bucket should be valid",
+			opts:    Options{Region: "eu-west-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour},
+			wantErr: false,
+		},
+		{
+			name:    "Local directory alone should be valid",
+			opts:    Options{LocalDir: "/tmp/foo", BatchSize: 1, PrefixStep: time.Hour},
+			wantErr: false,
+		},
+		{
+			name:    "SQS queue without region should return an error",
+			opts:    Options{LocalDir: "/tmp/foo", BatchSize: 1, PrefixStep: time.Hour, SQSQueueURL: "http://localhost:9324/queue/foo"},
+			wantErr: true,
+		},
+		{
+			name:    "SQS wait time above 20s should return an error",
+			opts:    Options{Region: "eu-west-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, SQSQueueURL: "http://localhost:9324/queue/foo", SQSWaitTime: time.Minute},
+			wantErr: true,
+		},
+		{
+			name:    "SQS queue with region should be valid",
+			opts:    Options{Region: "eu-west-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, SQSQueueURL: "http://localhost:9324/queue/foo", SQSWaitTime: 20 * time.Second},
+			wantErr: false,
+		},
+		{
+			name:    "Athena query and named query should return an error",
+			opts:    Options{Region: "eu-west-1", BatchSize: 1, PrefixStep: time.Hour, AthenaQuery: "SELECT 1", AthenaNamedQueryID: "foo"},
+			wantErr: true,
+		},
+		{
+			name:    "Athena query without region should return an error",
+			opts:    Options{BatchSize: 1, PrefixStep: time.Hour, AthenaQuery: "SELECT 1"},
+			wantErr: true,
+		},
+		{
+			name:    "Athena query with region should be valid without bucket",
+			opts:    Options{Region: "eu-west-1", BatchSize: 1, PrefixStep: time.Hour, AthenaQuery: "SELECT 1"},
+			wantErr: false,
+		},
+		{
+			name:    "Quote CSV delimiter should return an error",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, CSVDelimiter: '"'},
+			wantErr: true,
+		},
+		{
+			name:    "CSV comment identical to delimiter should return an error",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, CSVDelimiter: ';', CSVComment: ';'},
+			wantErr: true,
+		},
+		{
+			name:    "Negative CSV skipped lines should return an error",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, CSVSkipTrailingLines: -1},
+			wantErr: true,
+		},
+		{
+			name:    "TSV with comments and skipped lines should be valid",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, CSVDelimiter: '\t', CSVComment: '#', CSVSkipLeadingLines: 2, CSVSkipTrailingLines: 1},
+			wantErr: false,
+		},
+		{
+			name:    "Download concurrency without part size should return an error",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, DownloadConcurrency: 4},
+			wantErr: true,
+		},
+		{
+			name:    "Download concurrency with part size should be valid",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, DownloadConcurrency: 4, DownloadPartSize: 8 << 20},
+			wantErr: false,
+		},
+		{
+			name:    "Negative download max connections should return an error",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, DownloadMaxConnections: -1},
+			wantErr: true,
+		},
+		{
+			name:    "Role external ID without role should return an error",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, RoleExternalID: "ext"},
+			wantErr: true,
+		},
+		{
+			name:    "Role with external ID should be valid",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, RoleARN: "arn:aws:iam::123456789012:role/crawler", RoleExternalID: "ext"},
+			wantErr: false,
+		},
+		{
+			name:    "State role external ID without state role should return an error",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, StateStore: StateStoreDynamoDB, StateDynamoDBTable: "states", StateRoleExternalID: "ext"},
+			wantErr: true,
+		},
+		{
+			name:    "State role without DynamoDB state store nor archive bucket should return an error",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, StateRoleARN: "arn:aws:iam::123456789012:role/states"},
+			wantErr: true,
+		},
+		{
+			name:    "State role with DynamoDB state store should be valid",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, StateStore: StateStoreDynamoDB, StateDynamoDBTable: "states", StateRoleARN: "arn:aws:iam::123456789012:role/states"},
+			wantErr: false,
+		},
+		{
+			name:    "State role with archive bucket should be valid",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, CleanObjects: true, ArchiveBucket: "bar", StateRoleARN: "arn:aws:iam::123456789012:role/archive"},
+			wantErr: false,
+		},
+		{
+			name:    "S3 endpoint with local directory should return an error",
+			opts:    Options{LocalDir: "/tmp/foo", BatchSize: 1, PrefixStep: time.Hour, S3EndpointURL: "http://minio:9000"},
+			wantErr: true,
+		},
+		{
+			name:    "S3 endpoint with bucket should be valid",
+			opts:    Options{Region: "us-east-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, S3EndpointURL: "http://minio:9000", S3ForcePathStyle: true},
+			wantErr: false,
+		},
+		{
+			name:    "Tagging state store with local directory should return an error",
+			opts:    Options{LocalDir: "/tmp/foo", BatchSize: 1, PrefixStep: time.Hour, StateStore: StateStoreTagging},
+			wantErr: true,
+		},
+		{
+			name:    "File state store without file should return an error",
+			opts:    Options{LocalDir: "/tmp/foo", BatchSize: 1, PrefixStep: time.Hour, StateStore: StateStoreFile},
+			wantErr: true,
+		},
+		{
+			name:    "File state store with file should be valid",
+			opts:    Options{LocalDir: "/tmp/foo", BatchSize: 1, PrefixStep: time.Hour, StateStore: StateStoreFile, StateFile: "/tmp/state.db"},
+			wantErr: false,
+		},
+		{
+			name:    "DynamoDB state store without region should return an error",
+			opts:    Options{LocalDir: "/tmp/foo", BatchSize: 1, PrefixStep: time.Hour, StateStore: StateStoreDynamoDB, StateDynamoDBTable: "foo"},
+			wantErr: true,
+		},
+		{
+			name:    "DynamoDB state store with table and region should be valid",
+			opts:    Options{Region: "eu-west-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, StateStore: StateStoreDynamoDB, StateDynamoDBTable: "foo"},
+			wantErr: false,
+		},
+		{
+			name:    "Archive without cleanup should return an error",
+			opts:    Options{Region: "eu-west-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, ArchivePrefix: "archive/"},
+			wantErr: true,
+		},
+		{
+			name:    "Archive in the crawled bucket without prefix should return an error",
+			opts:    Options{Region: "eu-west-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, CleanObjects: true, ArchiveBucket: "foo"},
+			wantErr: true,
+		},
+		{
+			name:    "Archive bucket with local directory should return an error",
+			opts:    Options{LocalDir: "/tmp/foo", BatchSize: 1, PrefixStep: time.Hour, CleanObjects: true, ArchiveBucket: "bar"},
+			wantErr: true,
+		},
+		{
+			name:    "Archive storage class without archive should return an error",
+			opts:    Options{Region: "eu-west-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, CleanObjects: true, ArchiveStorageClass: "GLACIER_IR"},
+			wantErr: true,
+		},
+		{
+			name:    "Archive to another bucket should be valid",
+			opts:    Options{Region: "eu-west-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, CleanObjects: true, ArchiveBucket: "bar", ArchiveStorageClass: "GLACIER_IR"},
+			wantErr: false,
+		},
+		{
+			name:    "Null prefix step should return an error",
+			opts:    Options{LocalDir: "/tmp/foo", BatchSize: 1},
+			wantErr: true,
+		},
+		{
+			name:    "Null batch size should return an error",
+			opts:    Options{LocalDir: "/tmp/foo", PrefixStep: time.Hour},
+			wantErr: true,
+		},
+		{
+			name:    "Tagging state store with servers not fitting a tag should return an error",
+			opts:    Options{Region: "eu-west-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, StateStore: StateStoreTagging, InfluxServers: []string{"http://a:8086/?org=foo", "http://b:8086"}},
+			wantErr: true,
+		},
+		{
+			name:    "Tagging state store with several servers should be valid",
+			opts:    Options{Region: "eu-west-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, StateStore: StateStoreTagging, InfluxServers: []string{"http://a:8086", "http://b:8086"}},
+			wantErr: false,
+		},
+		{
+			name:    "Delete before rewrite without source tag should return an error",
+			opts:    Options{LocalDir: "/tmp/foo", BatchSize: 1, PrefixStep: time.Hour, DeleteBeforeRewrite: true},
+			wantErr: true,
+		},
+		{
+			name:    "Source tag among tags should return an error",
+			opts:    Options{LocalDir: "/tmp/foo", BatchSize: 1, PrefixStep: time.Hour, SourceTag: "foo", Tags: []*Tag{{Tag: "foo", Row: "foo"}}},
+			wantErr: true,
+		},
+		{
+			name:    "Delete before rewrite with tagging state store should return an error",
+			opts:    Options{Region: "eu-west-1", Bucket: "foo", BatchSize: 1, PrefixStep: time.Hour, DeleteBeforeRewrite: true, SourceTag: "source", StateStore: StateStoreTagging},
+			wantErr: true,
+		},
+		{
+			name:    "Delete before rewrite with source tag should be valid",
+			opts:    Options{LocalDir: "/tmp/foo", BatchSize: 1, PrefixStep: time.Hour, DeleteBeforeRewrite: true, SourceTag: "source"},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Options.validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPattern_Match(t *testing.T) {
+	tests := []struct {
+		name    string
+		arg     string
+		key     string
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:    "Invalid regular expression should return an error",
+			arg:     "re:foo(",
+			wantErr: true,
+		},
+		{
+			name: "Glob star should match a path segment",
+			arg:  "reports/*/daily/*.csv",
+			key:  "reports/foo/daily/bar.csv",
+			want: true,
+		},
+		{
+			name: "Glob star should not match several path segments",
+			arg:  "reports/*/daily/*.csv",
+			key:  "reports/foo/bar/daily/baz.csv",
+			want: false,
+		},
+		{
+			name: "Glob double star should match several path segments",
+			arg:  "**/tmp/**",
+			key:  "reports/foo/tmp/bar/baz.csv",
+			want: true,
+		},
+		{
+			name: "Glob should match the full key",
+			arg:  "*.csv",
+			key:  "foo.csv.metadata",
+			want: false,
+		},
+		{
+			name: "Glob special characters should be escaped",
+			arg:  "foo.csv",
+			key:  "fooXcsv",
+			want: false,
+		},
+		{
+			name: "Regular expression should match",
+			arg:  `re:^reports/\d{4}/.*\.csv$`,
+			key:  "reports/2024/foo.csv",
+			want: true,
+		},
+		{
+			name: "Regular expression should not be anchored implicitly",
+			arg:  "re:tmp/",
+			key:  "reports/tmp/foo.csv",
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pattern{}
+			if err := p.UnmarshalFlag(tt.arg); (err != nil) != tt.wantErr {
+				t.Fatalf("Pattern.UnmarshalFlag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := p.Match(tt.key); got != tt.want {
+				t.Errorf("Pattern.Match() = %v, want %v", got, tt.want)
+			}
+			if got, _ := p.MarshalFlag(); got != tt.arg {
+				t.Errorf("Pattern.MarshalFlag() = %v, want %v", got, tt.arg)
+			}
+		})
+	}
+}
+
+func TestSize_UnmarshalFlag(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    Size
+		wantErr bool
+	}{
+		{arg: "1024", want: 1024},
+		{arg: "512B", want: 512},
+		{arg: "8MiB", want: 8 << 20},
+		{arg: "10MB", want: 10_000_000},
+		{arg: "1GiB", want: 1 << 30},
+		{arg: "2 KB", want: 2000},
+		{arg: "foo", wantErr: true},
+		{arg: "-1MiB", wantErr: true},
+		{arg: "1TiB", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			var got Size
+			err := got.UnmarshalFlag(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Size.UnmarshalFlag() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Size.UnmarshalFlag() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChar_UnmarshalFlag(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    Char
+		wantErr bool
+	}{
+		{arg: ";", want: ';'},
+		{arg: "|", want: '|'},
+		{arg: `\t`, want: '\t'},
+		{arg: "\t", want: '\t'},
+		{arg: "", wantErr: true},
+		{arg: ";;", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			var got Char
+			err := got.UnmarshalFlag(tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Char.UnmarshalFlag() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Char.UnmarshalFlag() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
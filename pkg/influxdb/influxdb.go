@@ -2,8 +2,12 @@ package influxdb
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,58 +19,141 @@ import (
 
 // Writer describes what an InfluxDB writer should do
 type Writer interface {
-	WriteRecords(ctx context.Context, rows []map[string]interface{}) error
+	// WriteRecords converts given rows, read from given source object, to
+	// points with given fields and writes them to InfluxDB
+	WriteRecords(ctx context.Context, source string, rows []map[string]interface{}, fields []*flags.Field) (Stats, error)
+	// Delete deletes the measurement points written from given source
+	// object between given times (inclusive)
+	Delete(ctx context.Context, source string, start, stop time.Time) error
 	Close()
 }
 
+// Stats describes points written by a Writer
+type Stats struct {
+	Points           int64
+	MinTime, MaxTime time.Time
+}
+
+// Add merges given stats into s
+func (s *Stats) Add(o Stats) {
+	if o.Points == 0 {
+		return
+	}
+	if s.Points == 0 || o.MinTime.Before(s.MinTime) {
+		s.MinTime = o.MinTime
+	}
+	if s.Points == 0 || o.MaxTime.After(s.MaxTime) {
+		s.MaxTime = o.MaxTime
+	}
+	s.Points += o.Points
+}
+
+// pointsStats returns the stats of given points
+func pointsStats(points []*write.Point) Stats {
+	var s Stats
+	for _, p := range points {
+		s.Add(Stats{Points: 1, MinTime: p.Time(), MaxTime: p.Time()})
+	}
+	return s
+}
+
+// RowError is returned when a row cannot be converted to a point
+type RowError struct {
+	// Row is the index of the row in the written rows
+	Row int
+	// Column is the row column which could not be converted, if any
+	Column string
+	Err    error
+}
+
+// Error is the error implementation for RowError
+func (e *RowError) Error() string {
+	if e.Column == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("column %q: %s", e.Column, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
 // writer is the Writer implementation
 type writer struct {
 	cli             influxdb2.Client
 	api             api.WriteAPIBlocking
+	org, bucket     string
 	measurement     string
 	tsLayout, tsRow string
 	tags            []*flags.Tag
-	fields          []*flags.Field
+	nulls           nullSet
+	sourceTag       string
 }
 
-// NewWriter returns an Writer implementation from given parameters
+// NewWriter returns an Writer implementation from given parameters,
+// row values equal to one of the null tokens being null. Points are
+// tagged with their source object key under the source tag, if any.
 func NewWriter(
 	server, token, org, bucket, measurement, tsLayout, tsRow string,
 	tags []*flags.Tag,
-	fields []*flags.Field,
+	nullTokens []string,
+	sourceTag string,
 ) Writer {
 	cli := influxdb2.NewClient(server, token)
 	api := cli.WriteAPIBlocking(org, bucket)
 	return &writer{
 		cli:         cli,
 		api:         api,
+		org:         org,
+		bucket:      bucket,
 		measurement: measurement,
 		tsLayout:    tsLayout,
 		tsRow:       tsRow,
 		tags:        tags,
-		fields:      fields,
+		nulls:       newNullSet(nullTokens),
+		sourceTag:   sourceTag,
 	}
 }
 
 // WriteRecords parses given rows and write appropriate points to InfluxDB instance
-func (w *writer) WriteRecords(ctx context.Context, rows []map[string]interface{}) error {
+func (w *writer) WriteRecords(ctx context.Context, source string, rows []map[string]interface{}, fields []*flags.Field) (Stats, error) {
 	// Convert csv rows to InfluxDB points
-	points, err := toPoints(rows, w.measurement, w.tsLayout, w.tsRow, w.tags, w.fields)
+	points, err := toPoints(rows, w.measurement, w.tsLayout, w.tsRow, w.tags, fields, w.nulls)
 	if err != nil {
-		return fmt.Errorf("failed to convert CSV rows to points: %s", err)
+		return Stats{}, fmt.Errorf("failed to convert CSV rows to points: %w", err)
+	}
+	if w.sourceTag != "" {
+		for _, p := range points {
+			p.AddTag(w.sourceTag, source)
+		}
 	}
 
 	// No points to write, return immediately
 	if len(points) == 0 {
-		return nil
+		return Stats{}, nil
 	}
 
 	// Write points to InfluxDB
 	err = w.api.WritePoint(context.Background(), points...)
 	if err != nil {
-		return fmt.Errorf("failed to write points to InfluxDB: %s", err)
+		return Stats{}, fmt.Errorf("failed to write points to InfluxDB: %s", err)
 	}
 
+	return pointsStats(points), nil
+}
+
+// Delete deletes the measurement points written from given source object
+// between given times from InfluxDB instance, which requires a source tag
+// so that points of other objects are kept
+func (w *writer) Delete(ctx context.Context, source string, start, stop time.Time) error {
+	if w.sourceTag == "" {
+		return errors.New("failed to delete points from InfluxDB: no source tag to select them")
+	}
+	predicate := fmt.Sprintf("_measurement=%q AND %s=%q", w.measurement, w.sourceTag, source)
+	if err := w.cli.DeleteAPI().DeleteWithName(ctx, w.org, w.bucket, start, stop, predicate); err != nil {
+		return fmt.Errorf("failed to delete points from InfluxDB: %s", err)
+	}
 	return nil
 }
 
@@ -75,39 +162,51 @@ func (w *writer) Close() {
 	w.cli.Close()
 }
 
-// toPoints converts rows slice to InfluxDB points slice
+// toPoints converts rows slice to InfluxDB points slice, rejected rows
+// and rows whose fields are all null being dropped
 func toPoints(
 	rows []map[string]interface{},
 	measurement string,
 	tsLayout, tsRow string,
 	tags []*flags.Tag,
 	fields []*flags.Field,
+	nulls nullSet,
 ) ([]*write.Point, error) {
 	if rows == nil {
 		return nil, nil
 	}
-	res := make([]*write.Point, len(rows))
+	res := make([]*write.Point, 0, len(rows))
 	for i, e := range rows {
-		p, err := toPoint(e, measurement, tsLayout, tsRow, tags, fields)
+		p, err := toPoint(e, measurement, tsLayout, tsRow, tags, fields, nulls)
 		if err != nil {
+			var rErr *RowError
+			if errors.As(err, &rErr) {
+				rErr.Row = i
+			}
 			return nil, err
 		}
-		res[i] = p
+		if p != nil {
+			res = append(res, p)
+		}
 	}
 	return res, nil
 }
 
-// toPoints converts rows to InfluxDB points
+// toPoints converts rows to InfluxDB points, nil if the row is rejected
+// or its fields are all null.
+// Null tags are omitted, null fields are handled according to their
+// null policy.
 func toPoint(
 	row map[string]interface{},
 	measurement string,
 	tsLayout, tsRow string,
 	tags []*flags.Tag,
 	fields []*flags.Field,
+	nulls nullSet,
 ) (*write.Point, error) {
-	t, err := time.Parse(tsLayout, fmt.Sprintf("%v", row[tsRow]))
+	t, err := toTime(row[tsRow], tsLayout)
 	if err != nil {
-		return nil, err
+		return nil, &RowError{Column: tsRow, Err: err}
 	}
 
 	if measurement == "" {
@@ -117,7 +216,7 @@ func toPoint(
 	point := influxdb2.NewPointWithMeasurement(measurement).SetTime(t)
 	for _, e := range tags {
 		val, ok := row[e.Row]
-		if !ok {
+		if !ok || nulls.isNull(val) {
 			continue
 		}
 		point = point.AddTag(e.Tag, fmt.Sprintf("%v", val))
@@ -128,103 +227,288 @@ func toPoint(
 		if !ok {
 			continue
 		}
-		var fieldVal interface{}
-		strField := fmt.Sprintf("%v", val)
-		switch e.FieldType {
-		case flags.FieldTypeBool:
-			fieldVal, err = strconv.ParseBool(strField)
-		case flags.FieldTypeFloat:
-			fieldVal, err = strconv.ParseFloat(strField, 64)
-		case flags.FieldTypeInteger:
-			fieldVal, err = strconv.Atoi(strField)
-		case flags.FieldTypeString:
-			fieldVal = strField
+		if nulls.isNull(val) {
+			switch e.Null {
+			case flags.NullPolicyReject:
+				return nil, nil
+			case flags.NullPolicyDefault:
+				val = e.Default
+			default:
+				continue
+			}
 		}
+		fieldVal, err := toFieldValue(val, e.FieldType)
 		if err != nil {
-			return nil, err
+			return nil, &RowError{Column: e.Row, Err: err}
 		}
 		point = point.AddField(e.Field, fieldVal)
 	}
 
+	// Points whose fields are all null (or missing) are not written
+	if len(fields) > 0 && len(point.FieldList()) == 0 {
+		return nil, nil
+	}
 	return point, nil
 }
 
-// writers is a Writer implementation for multiple Writers
-type writers []Writer
+// nullSet holds the tokens standing for null values
+type nullSet map[string]struct{}
+
+// newNullSet returns the nullSet of given tokens
+func newNullSet(tokens []string) nullSet {
+	res := make(nullSet, len(tokens))
+	for _, t := range tokens {
+		res[t] = struct{}{}
+	}
+	return res
+}
+
+// isNull returns whether given row value is null: a nil value, a null
+// token or a NaN float if NaN is a null token
+func (n nullSet) isNull(val interface{}) bool {
+	switch v := val.(type) {
+	case nil:
+		return true
+	case string:
+		_, ok := n[v]
+		return ok
+	case float64:
+		_, ok := n["NaN"]
+		return ok && math.IsNaN(v)
+	case float32:
+		_, ok := n["NaN"]
+		return ok && math.IsNaN(float64(v))
+	}
+	return false
+}
+
+// toFieldValue converts a row value to given field type.
+// Natively typed values (e.g. from JSON or Parquet) are converted
+// directly, other values are parsed from their string representation.
+func toFieldValue(val interface{}, fieldType flags.FieldType) (interface{}, error) {
+	switch fieldType {
+	case flags.FieldTypeBool:
+		if b, ok := val.(bool); ok {
+			return b, nil
+		}
+		return strconv.ParseBool(fmt.Sprintf("%v", val))
+	case flags.FieldTypeFloat:
+		switch v := val.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		}
+		return strconv.ParseFloat(fmt.Sprintf("%v", val), 64)
+	case flags.FieldTypeInteger:
+		switch v := val.(type) {
+		case int64, int:
+			return v, nil
+		case int32:
+			return int64(v), nil
+		case float64:
+			return floatToInt(v)
+		case float32:
+			return floatToInt(float64(v))
+		}
+		return strconv.Atoi(fmt.Sprintf("%v", val))
+	case flags.FieldTypeString:
+		if str, ok := val.(string); ok {
+			return str, nil
+		}
+		return fmt.Sprintf("%v", val), nil
+	case flags.FieldTypeAuto:
+		return val, nil
+	}
+	return nil, fmt.Errorf("invalid field type %q", fieldType)
+}
+
+// floatToInt converts given float to int64 if it is an integer (e.g. a
+// JSON number such as 1e6)
+func floatToInt(f float64) (int64, error) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, fmt.Errorf("%v is not an integer", f)
+	}
+	return int64(f), nil
+}
+
+// toTime converts a row timestamp to time.Time, parsing it with
+// given layout unless it is already typed
+func toTime(val interface{}, layout string) (time.Time, error) {
+	if t, ok := val.(time.Time); ok {
+		return t, nil
+	}
+	return time.Parse(layout, fmt.Sprintf("%v", val))
+}
+
+// Writers describes a Writer writing to several InfluxDB servers
+type Writers interface {
+	Writer
+	// Servers returns the addresses of the servers written to
+	Servers() []string
+	// Only returns Writers writing to given servers only, sharing
+	// clients with these ones
+	Only(servers ...string) Writers
+}
+
+// ServersError is returned by Writers when some servers failed
+type ServersError struct {
+	// Errors holds errors by server address
+	Errors map[string]error
+}
+
+// Error is the error implementation for ServersError
+func (e *ServersError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, server := range e.Servers() {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", server, e.Errors[server]))
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// Unwrap returns the servers errors
+func (e *ServersError) Unwrap() []error {
+	res := make([]error, 0, len(e.Errors))
+	for _, server := range e.Servers() {
+		res = append(res, e.Errors[server])
+	}
+	return res
+}
+
+// Servers returns the failed servers addresses, sorted
+func (e *ServersError) Servers() []string {
+	res := make([]string, 0, len(e.Errors))
+	for server := range e.Errors {
+		res = append(res, server)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// serverWriter is a Writer for a known server
+type serverWriter struct {
+	Writer
+	server string
+}
+
+// writers is a Writers implementation for multiple Writers
+type writers []serverWriter
 
 // NewWriters returns a Writers implementation from given parameters
 func NewWriters(
 	servers []string,
 	token, org, bucket, measurement, tsLayout, tsRow string,
 	tags []*flags.Tag,
-	fields []*flags.Field,
-) Writer {
+	nullTokens []string,
+	sourceTag string,
+) Writers {
 	w := make(writers, len(servers))
 	for i, server := range servers {
-		w[i] = NewWriter(
-			server,
-			token,
-			org,
-			bucket,
-			measurement,
-			tsLayout,
-			tsRow,
-			tags,
-			fields,
-		)
+		w[i] = serverWriter{
+			Writer: NewWriter(
+				server,
+				token,
+				org,
+				bucket,
+				measurement,
+				tsLayout,
+				tsRow,
+				tags,
+				nullTokens,
+				sourceTag,
+			),
+			server: server,
+		}
 	}
 
 	return &w
 }
 
-// WriteRecords parses given rows and write appropriate points to InfluxDB instance
-func (w *writers) WriteRecords(ctx context.Context, rows []map[string]interface{}) error {
-	// Make waitgroup and channels to process
-	// tasks asynchronously
+// apply calls fn concurrently for each writer, errors are returned as a
+// *ServersError
+func (w *writers) apply(fn func(w Writer) error) error {
 	var wg sync.WaitGroup
-	cDone := make(chan bool)
-	cErr := make(chan error)
+	var mu sync.Mutex
+	errs := map[string]error{}
 	wg.Add(len(*w))
-
-	go func() {
-		for _, item := range *w {
-			writer := item
-			go func() {
-				defer wg.Done()
-				if err := writer.WriteRecords(ctx, rows); err != nil {
-					cErr <- err
-				}
-			}()
-		}
-		wg.Wait()
-		close(cDone)
-	}()
-
-	// Wait until either WaitGroup is done or an error is received through the channel
-	select {
-	case <-cDone:
-		break
-	case err := <-cErr:
-		return err
+	for _, item := range *w {
+		writer := item
+		go func() {
+			defer wg.Done()
+			if err := fn(writer.Writer); err != nil {
+				mu.Lock()
+				errs[writer.server] = err
+				mu.Unlock()
+			}
+		}()
 	}
+	wg.Wait()
 
+	if len(errs) > 0 {
+		return &ServersError{Errors: errs}
+	}
 	return nil
 }
 
-// Close closes InfluxDB client
-func (w *writers) Close() {
-	var wg sync.WaitGroup
-	wg.Add(len(*w))
+// WriteRecords parses given rows and write appropriate points to InfluxDB instance.
+// Every writer writing the same points, stats are those of any successful
+// one. If some servers failed, a *ServersError is returned along with the
+// stats of the successful ones.
+func (w *writers) WriteRecords(ctx context.Context, source string, rows []map[string]interface{}, fields []*flags.Field) (Stats, error) {
+	var mu sync.Mutex
+	var stats Stats
+	err := w.apply(func(writer Writer) error {
+		s, err := writer.WriteRecords(ctx, source, rows, fields)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		stats = s
+		mu.Unlock()
+		return nil
+	})
+	return stats, err
+}
+
+// Delete deletes the measurement points written from given source object
+// between given times from all InfluxDB instances
+func (w *writers) Delete(ctx context.Context, source string, start, stop time.Time) error {
+	return w.apply(func(writer Writer) error {
+		return writer.Delete(ctx, source, start, stop)
+	})
+}
+
+// Servers is the Writers Servers implementation
+func (w *writers) Servers() []string {
+	res := make([]string, len(*w))
+	for i, writer := range *w {
+		res[i] = writer.server
+	}
+	return res
+}
 
-	go func() {
-		for _, item := range *w {
-			writer := item
-			go func() {
-				defer wg.Done()
-				writer.Close()
-			}()
+// Only is the Writers Only implementation
+func (w *writers) Only(servers ...string) Writers {
+	res := writers{}
+	for _, writer := range *w {
+		for _, server := range servers {
+			if writer.server == server {
+				res = append(res, writer)
+				break
+			}
 		}
-	}()
+	}
+	return &res
+}
 
-	wg.Wait()
+// Close closes InfluxDB clients
+func (w *writers) Close() {
+	_ = w.apply(func(writer Writer) error {
+		writer.Close()
+		return nil
+	})
 }
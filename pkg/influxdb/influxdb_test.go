@@ -1,13 +1,26 @@
 package influxdb
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"testing"
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	pq "github.com/parquet-go/parquet-go"
 	"github.com/quortex/influxdb-athena-crawler/pkg/flags"
+	"github.com/quortex/influxdb-athena-crawler/pkg/jsonl"
+	"github.com/quortex/influxdb-athena-crawler/pkg/parquet"
 )
 
 func Test_toPoints(t *testing.T) {
@@ -105,6 +118,40 @@ func Test_toPoints(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Typed timestamp and auto fields should be used as is",
+			args: args{
+				rows: []map[string]interface{}{
+					{
+						"timestamp": time.Date(2021, 6, 30, 13, 6, 18, 0, time.UTC),
+						"audience":  int64(6892),
+						"ratio":     0.5,
+					},
+				},
+				measurement: "foo",
+				tsLayout:    "2006-01-02T15:04:05.000Z",
+				tsRow:       "timestamp",
+				fields: []*flags.Field{
+					{
+						Row:       "audience",
+						Field:     "audience",
+						FieldType: flags.FieldTypeAuto,
+					},
+					{
+						Row:       "ratio",
+						Field:     "ratio",
+						FieldType: flags.FieldTypeAuto,
+					},
+				},
+			},
+			want: []*write.Point{
+				influxdb2.NewPointWithMeasurement("foo").
+					SetTime(time.Date(2021, 6, 30, 13, 6, 18, 0, time.UTC)).
+					AddField("audience", int64(6892)).
+					AddField("ratio", 0.5),
+			},
+			wantErr: false,
+		},
 		{
 			name: "Missing row for tag or field should be ignored",
 			args: args{
@@ -230,7 +277,7 @@ func Test_toPoints(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := toPoints(tt.args.rows, tt.args.measurement, tt.args.tsLayout, tt.args.tsRow, tt.args.tags, tt.args.fields)
+			got, err := toPoints(tt.args.rows, tt.args.measurement, tt.args.tsLayout, tt.args.tsRow, tt.args.tags, tt.args.fields, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("toPoints() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -241,3 +288,407 @@ func Test_toPoints(t *testing.T) {
 		})
 	}
 }
+
+func Test_toFieldValue(t *testing.T) {
+	type args struct {
+		val       interface{}
+		fieldType flags.FieldType
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:    "String should be parsed to float",
+			args:    args{val: "12.76", fieldType: flags.FieldTypeFloat},
+			want:    12.76,
+			wantErr: false,
+		},
+		{
+			name:    "Native float should be kept",
+			args:    args{val: 12.76, fieldType: flags.FieldTypeFloat},
+			want:    12.76,
+			wantErr: false,
+		},
+		{
+			name:    "Native integer should be converted to float",
+			args:    args{val: int64(12), fieldType: flags.FieldTypeFloat},
+			want:    float64(12),
+			wantErr: false,
+		},
+		{
+			name:    "Native integer should be kept",
+			args:    args{val: int64(9007199254740993), fieldType: flags.FieldTypeInteger},
+			want:    int64(9007199254740993),
+			wantErr: false,
+		},
+		{
+			name:    "Native float should not be converted to integer",
+			args:    args{val: 12.76, fieldType: flags.FieldTypeInteger},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "Integral native float should be converted to integer",
+			args:    args{val: 1e6, fieldType: flags.FieldTypeInteger},
+			want:    int64(1000000),
+			wantErr: false,
+		},
+		{
+			name:    "Integral native float32 should be converted to integer",
+			args:    args{val: float32(-42), fieldType: flags.FieldTypeInteger},
+			want:    int64(-42),
+			wantErr: false,
+		},
+		{
+			name:    "Native float out of integer range should not be converted to integer",
+			args:    args{val: 1e19, fieldType: flags.FieldTypeInteger},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "Native NaN should not be converted to integer",
+			args:    args{val: math.NaN(), fieldType: flags.FieldTypeInteger},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "Native boolean should be kept",
+			args:    args{val: false, fieldType: flags.FieldTypeBool},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name:    "Native value should be formatted to string",
+			args:    args{val: int64(12), fieldType: flags.FieldTypeString},
+			want:    "12",
+			wantErr: false,
+		},
+		{
+			name:    "Invalid field type should return an error",
+			args:    args{val: "foo", fieldType: flags.FieldType("foo")},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toFieldValue(tt.args.val, tt.args.fieldType)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("toFieldValue() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("toFieldValue() = %v (%T), want %v (%T)", got, got, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestStats_Add(t *testing.T) {
+	t1 := time.Date(2021, 6, 30, 13, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	t3 := t2.Add(time.Hour)
+
+	var s Stats
+	s.Add(Stats{})
+	if s != (Stats{}) {
+		t.Errorf("Stats.Add() of empty stats = %v, want empty stats", s)
+	}
+	s.Add(Stats{Points: 2, MinTime: t2, MaxTime: t2})
+	s.Add(Stats{Points: 1, MinTime: t1, MaxTime: t1})
+	s.Add(Stats{Points: 3, MinTime: t2, MaxTime: t3})
+	want := Stats{Points: 6, MinTime: t1, MaxTime: t3}
+	if s != want {
+		t.Errorf("Stats.Add() = %v, want %v", s, want)
+	}
+}
+
+func Test_writer_Delete(t *testing.T) {
+	var got map[string]string
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode delete request: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w := NewWriter(srv.URL, "token", "org", "bucket", "foo", "", "timestamp", nil, nil, "source")
+	defer w.Close()
+	start := time.Date(2021, 6, 30, 13, 0, 0, 0, time.UTC)
+	stop := start.Add(time.Hour)
+	if err := w.Delete(context.Background(), "reports/foo.csv", start, stop); err != nil {
+		t.Fatalf("writer.Delete() error = %v", err)
+	}
+
+	want := map[string]string{
+		"start":     "2021-06-30T13:00:00Z",
+		"stop":      "2021-06-30T14:00:00Z",
+		"predicate": `_measurement="foo" AND source="reports/foo.csv"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("writer.Delete() request = %v, want %v", got, want)
+	}
+	if query.Get("org") != "org" || query.Get("bucket") != "bucket" {
+		t.Errorf("writer.Delete() query = %v", query)
+	}
+
+	// Points of other objects cannot be told apart without source tag
+	w = NewWriter(srv.URL, "token", "org", "bucket", "foo", "", "timestamp", nil, nil, "")
+	defer w.Close()
+	got = nil
+	if err := w.Delete(context.Background(), "reports/foo.csv", start, stop); err == nil {
+		t.Errorf("writer.Delete() without source tag error = nil, want an error")
+	}
+	if got != nil {
+		t.Errorf("writer.Delete() without source tag request = %v, want none", got)
+	}
+}
+
+func Test_writer_WriteRecords_sourceTag(t *testing.T) {
+	var got []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w := NewWriter(srv.URL, "token", "org", "bucket", "foo", "2006-01-02T15:04:05.000Z", "timestamp", []*flags.Tag{{Tag: "pp", Row: "pp"}}, nil, "source")
+	defer w.Close()
+	rows := []map[string]interface{}{{"timestamp": "2021-06-30T13:00:00.000Z", "pp": "/bar", "audience": "12"}}
+	fields := []*flags.Field{{Field: "audience", Row: "audience", FieldType: flags.FieldTypeInteger}}
+	if _, err := w.WriteRecords(context.Background(), "reports/foo.csv", rows, fields); err != nil {
+		t.Fatalf("writer.WriteRecords() error = %v", err)
+	}
+
+	want := "foo,pp=/bar,source=reports/foo.csv audience=12i 1625058000000000000\n"
+	if string(got) != want {
+		t.Errorf("writer.WriteRecords() body = %q, want %q", got, want)
+	}
+}
+
+// fakeWriter is a Writer implementation counting written rows
+type fakeWriter struct {
+	err  error
+	rows int
+}
+
+func (w *fakeWriter) WriteRecords(_ context.Context, _ string, rows []map[string]interface{}, _ []*flags.Field) (Stats, error) {
+	if w.err != nil {
+		return Stats{}, w.err
+	}
+	w.rows += len(rows)
+	return Stats{Points: int64(len(rows))}, nil
+}
+
+func (w *fakeWriter) Delete(_ context.Context, _ string, _, _ time.Time) error {
+	return w.err
+}
+
+func (w *fakeWriter) Close() {}
+
+func Test_writers(t *testing.T) {
+	errFail := errors.New("fail")
+	a, b, c := &fakeWriter{}, &fakeWriter{err: errFail}, &fakeWriter{}
+	w := &writers{{Writer: a, server: "a"}, {Writer: b, server: "b"}, {Writer: c, server: "c"}}
+	rows := []map[string]interface{}{{"foo": "bar"}, {"foo": "baz"}}
+
+	stats, err := w.WriteRecords(context.Background(), "foo.csv", rows, nil)
+	var sErr *ServersError
+	if !errors.As(err, &sErr) {
+		t.Fatalf("writers.WriteRecords() error = %v, want *ServersError", err)
+	}
+	if got := sErr.Servers(); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("writers.WriteRecords() failed servers = %v, want [b]", got)
+	}
+	if stats.Points != 2 || a.rows != 2 || c.rows != 2 {
+		t.Errorf("writers.WriteRecords() stats = %v, rows = %d, %d, want 2 points written to healthy servers", stats, a.rows, c.rows)
+	}
+
+	// Writing only to missing servers should leave others untouched
+	only := w.Only("b", "c")
+	if got := only.Servers(); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("writers.Only() servers = %v, want [b c]", got)
+	}
+	b.err = nil
+	if _, err := only.WriteRecords(context.Background(), "foo.csv", rows, nil); err != nil {
+		t.Fatalf("writers.WriteRecords() error = %v", err)
+	}
+	if a.rows != 2 || b.rows != 2 || c.rows != 4 {
+		t.Errorf("writers.WriteRecords() rows = %d, %d, %d, want 2, 2, 4", a.rows, b.rows, c.rows)
+	}
+}
+
+func Test_toPoints_RowError(t *testing.T) {
+	rows := []map[string]interface{}{
+		{"timestamp": "2021-06-30T13:06:18.000Z", "foo": "1"},
+		{"timestamp": "2021-06-30T13:06:19.000Z", "foo": "bar"},
+	}
+	fields := []*flags.Field{{Row: "foo", Field: "foo", FieldType: flags.FieldTypeInteger}}
+	_, err := toPoints(rows, "m", "2006-01-02T15:04:05.000Z", "timestamp", nil, fields, nil)
+
+	// Errors should be found through writers errors too
+	err = &ServersError{Errors: map[string]error{"a": fmt.Errorf("failed: %w", err)}}
+	var rErr *RowError
+	if !errors.As(err, &rErr) {
+		t.Fatalf("toPoints() error = %v, want *RowError", err)
+	}
+	if rErr.Row != 1 || rErr.Column != "foo" {
+		t.Errorf("toPoints() error row = %d, column = %q, want 1, %q", rErr.Row, rErr.Column, "foo")
+	}
+}
+
+// typedNullsRow is a Parquet row with null values
+type typedNullsRow struct {
+	Timestamp time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	Audience  *int64    `parquet:"audience,optional"`
+	Ratio     *float64  `parquet:"ratio,optional"`
+}
+
+func Test_toPoints_typedNulls(t *testing.T) {
+	ts := time.Date(2021, 6, 30, 13, 6, 18, 0, time.UTC)
+	audience, ratio := int64(3), 0.5
+	var buf bytes.Buffer
+	if err := pq.Write(&buf, []typedNullsRow{
+		{Timestamp: ts, Ratio: &ratio},
+		{Timestamp: ts, Audience: &audience},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var parquetRows []map[string]interface{}
+	if err := parquet.ParseFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()), func(row map[string]interface{}) error {
+		parquetRows = append(parquetRows, row)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	jsonlRows, err := jsonl.ParseString(`{"timestamp":"2021-06-30T13:06:18.000Z","audience":null,"ratio":0.5}
+{"timestamp":"2021-06-30T13:06:18.000Z","audience":3,"ratio":null}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first row null audience gets its default, the second row null
+	// ratio rejects it
+	fields := []*flags.Field{
+		{Row: "audience", Field: "audience", FieldType: flags.FieldTypeInteger, Null: flags.NullPolicyDefault, Default: "0"},
+		{Row: "ratio", Field: "ratio", FieldType: flags.FieldTypeFloat, Null: flags.NullPolicyReject},
+	}
+	want := []*write.Point{
+		influxdb2.NewPointWithMeasurement("m").SetTime(ts).AddField("audience", 0).AddField("ratio", 0.5),
+	}
+	tests := []struct {
+		name string
+		rows []map[string]interface{}
+	}{
+		{name: "Parquet", rows: parquetRows},
+		{name: "JSON Lines", rows: jsonlRows},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toPoints(tt.rows, "m", "2006-01-02T15:04:05.000Z", "timestamp", nil, fields, newNullSet(nil))
+			if err != nil {
+				t.Fatalf("toPoints() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("toPoints() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func Test_toPoints_nativeIntegers(t *testing.T) {
+	// JSON Lines numbers written with a fraction or an exponent (e.g. 1e6)
+	// are decoded as float64
+	rows := []map[string]interface{}{
+		{"timestamp": "2021-06-30T13:06:18.000Z", "foo": 1e6},
+		{"timestamp": "2021-06-30T13:06:19.000Z", "foo": 12.5},
+	}
+	fields := []*flags.Field{{Row: "foo", Field: "foo", FieldType: flags.FieldTypeInteger}}
+	points, err := toPoints(rows[:1], "m", "2006-01-02T15:04:05.000Z", "timestamp", nil, fields, nil)
+	if err != nil {
+		t.Fatalf("toPoints() error = %v", err)
+	}
+	if got := points[0].FieldList()[0].Value; got != int64(1000000) {
+		t.Errorf("toPoints() field = %v (%T), want 1000000 (int64)", got, got)
+	}
+
+	_, err = toPoints(rows, "m", "2006-01-02T15:04:05.000Z", "timestamp", nil, fields, nil)
+	var rErr *RowError
+	if !errors.As(err, &rErr) {
+		t.Fatalf("toPoints() error = %v, want *RowError", err)
+	}
+	if rErr.Row != 1 || rErr.Column != "foo" {
+		t.Errorf("toPoints() error row = %d, column = %q, want 1, %q", rErr.Row, rErr.Column, "foo")
+	}
+}
+
+func Test_toPoints_nulls(t *testing.T) {
+	ts := time.Date(2021, 6, 30, 13, 6, 18, 0, time.UTC)
+	nulls := newNullSet([]string{"", "NULL", `\N`, "NaN"})
+	tags := []*flags.Tag{{Tag: "pp", Row: "pp"}}
+
+	tests := []struct {
+		name   string
+		row    map[string]interface{}
+		fields []*flags.Field
+		want   []*write.Point
+	}{
+		{
+			name: "Null fields and tags should be omitted by default",
+			row:  map[string]interface{}{"timestamp": "2021-06-30T13:06:18.000Z", "pp": "NULL", "audience": "", "ratio": "0.5"},
+			fields: []*flags.Field{
+				{Row: "audience", Field: "audience", FieldType: flags.FieldTypeInteger},
+				{Row: "ratio", Field: "ratio", FieldType: flags.FieldTypeFloat, Null: flags.NullPolicyOmit},
+			},
+			want: []*write.Point{
+				influxdb2.NewPointWithMeasurement("m").SetTime(ts).AddField("ratio", 0.5),
+			},
+		},
+		{
+			name: "Null fields should be written with their default value",
+			row:  map[string]interface{}{"timestamp": "2021-06-30T13:06:18.000Z", "pp": "/foo", "audience": `\N`},
+			fields: []*flags.Field{
+				{Row: "audience", Field: "audience", FieldType: flags.FieldTypeInteger, Null: flags.NullPolicyDefault, Default: "0"},
+			},
+			want: []*write.Point{
+				influxdb2.NewPointWithMeasurement("m").SetTime(ts).AddTag("pp", "/foo").AddField("audience", 0),
+			},
+		},
+		{
+			name: "Null fields should reject the row",
+			row:  map[string]interface{}{"timestamp": "2021-06-30T13:06:18.000Z", "audience": "12", "ratio": ""},
+			fields: []*flags.Field{
+				{Row: "audience", Field: "audience", FieldType: flags.FieldTypeInteger},
+				{Row: "ratio", Field: "ratio", FieldType: flags.FieldTypeFloat, Null: flags.NullPolicyReject},
+			},
+			want: []*write.Point{},
+		},
+		{
+			name: "Points whose fields are all null should be dropped",
+			row:  map[string]interface{}{"timestamp": "2021-06-30T13:06:18.000Z", "pp": "/foo", "audience": nil, "ratio": math.NaN()},
+			fields: []*flags.Field{
+				{Row: "audience", Field: "audience", FieldType: flags.FieldTypeAuto},
+				{Row: "ratio", Field: "ratio", FieldType: flags.FieldTypeAuto},
+			},
+			want: []*write.Point{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toPoints([]map[string]interface{}{tt.row}, "m", "2006-01-02T15:04:05.000Z", "timestamp", tags, tt.fields, nulls)
+			if err != nil {
+				t.Fatalf("toPoints() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("toPoints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
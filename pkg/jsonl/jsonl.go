@@ -0,0 +1,122 @@
+package jsonl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseString parses a JSON Lines string to a map[string]interface{} slice
+func ParseString(strJSONL string) ([]map[string]interface{}, error) {
+	res := []map[string]interface{}{}
+	err := ParseReader(strings.NewReader(strJSONL), func(row map[string]interface{}) error {
+		res = append(res, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Error locates an invalid JSON Lines record
+type Error struct {
+	// Line is the line (starting at 1) of the record, JSON Lines holding
+	// a record per line
+	Line int
+	Err  error
+}
+
+// Error is the error implementation for Error
+func (e *Error) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Reader reads JSON objects from a JSON Lines stream one at a time
+type Reader struct {
+	dec  *json.Decoder
+	line int
+}
+
+// NewReader returns a Reader reading JSON Lines from given reader
+func NewReader(r io.Reader) *Reader {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &Reader{dec: dec}
+}
+
+// Read returns the next object as a map[string]interface{}, or io.EOF
+// once all objects are read.
+// Nested objects are flattened with dotted keys ({"a":{"b":1}} becomes
+// {"a.b":1}), numbers are kept as int64 or float64, booleans as bool
+// and null values as nil. Invalid records are returned as *Error.
+func (r *Reader) Read() (map[string]interface{}, error) {
+	r.line++
+	var obj map[string]interface{}
+	if err := r.dec.Decode(&obj); err == io.EOF {
+		return nil, err
+	} else if err != nil {
+		return nil, &Error{Line: r.line, Err: err}
+	}
+
+	row := make(map[string]interface{}, len(obj))
+	flatten(row, "", obj)
+	return row, nil
+}
+
+// Line returns the line (starting at 1) of the last object read
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// ParseReader reads JSON objects (one per line) from given reader and
+// calls fn for each of them as a map[string]interface{}, one at a time,
+// as returned by Reader.Read.
+// Parsing stops at the first error returned by fn.
+func ParseReader(r io.Reader, fn func(row map[string]interface{}) error) error {
+	reader := NewReader(r)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// flatten adds values of given object to row, nested objects keys being
+// prefixed with their parent key
+func flatten(row map[string]interface{}, prefix string, obj map[string]interface{}) {
+	for k, v := range obj {
+		key := prefix + k
+		switch val := v.(type) {
+		case map[string]interface{}:
+			flatten(row, key+".", val)
+		case json.Number:
+			row[key] = toNumber(val)
+		default:
+			row[key] = val
+		}
+	}
+}
+
+// toNumber converts a JSON number to int64 if possible, float64 otherwise
+func toNumber(n json.Number) interface{} {
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
@@ -0,0 +1,103 @@
+package jsonl
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ParseString(t *testing.T) {
+	type args struct {
+		strJSONL string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "An invalid JSON Lines should return an error",
+			args: args{
+				strJSONL: `{"timestamp":"2021-06-24T06:00:00.000Z","publishing_point":"/foo_bar_00"}
+{"timestamp":"2021-06-24T06:00:00.000Z","publishing_point":`,
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "A valid JSON Lines should be parsed with native types",
+			args: args{
+				strJSONL: `{"timestamp":"2021-06-24T06:00:00.000Z","publishing_point":"/foo_bar_00","audience":6892,"ratio":0.5,"live":true}
+{"timestamp":"2021-06-24T06:00:00.000Z","publishing_point":"/foo_bar_01","audience":7945,"ratio":1.25,"live":false,"comment":null}
+`,
+			},
+			want: []map[string]interface{}{
+				{
+					"timestamp":        "2021-06-24T06:00:00.000Z",
+					"publishing_point": "/foo_bar_00",
+					"audience":         int64(6892),
+					"ratio":            0.5,
+					"live":             true,
+				},
+				{
+					"timestamp":        "2021-06-24T06:00:00.000Z",
+					"publishing_point": "/foo_bar_01",
+					"audience":         int64(7945),
+					"ratio":            1.25,
+					"live":             false,
+					"comment":          nil,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Nested objects should be flattened with dotted keys",
+			args: args{
+				strJSONL: `{"timestamp":"2021-06-24T06:00:00.000Z","stream":{"publishing_point":"/foo_bar_00","stats":{"audience":6892}}}`,
+			},
+			want: []map[string]interface{}{
+				{
+					"timestamp":               "2021-06-24T06:00:00.000Z",
+					"stream.publishing_point": "/foo_bar_00",
+					"stream.stats.audience":   int64(6892),
+				},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseString(tt.args.strJSONL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseString() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseString() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReader_Line(t *testing.T) {
+	r := NewReader(strings.NewReader(`{"a":1}
+{"a":2}
+{"a":
+`))
+	for want := 1; want <= 2; want++ {
+		if _, err := r.Read(); err != nil {
+			t.Fatalf("Reader.Read() error = %v", err)
+		}
+		if got := r.Line(); got != want {
+			t.Errorf("Reader.Line() = %d, want %d", got, want)
+		}
+	}
+
+	_, err := r.Read()
+	var jErr *Error
+	if !errors.As(err, &jErr) || jErr.Line != 3 {
+		t.Errorf("Reader.Read() error = %v, want an *Error on line 3", err)
+	}
+}
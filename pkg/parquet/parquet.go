@@ -0,0 +1,231 @@
+package parquet
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	pq "github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+)
+
+// rowBufferSize is the number of rows read at once from a row group
+const rowBufferSize = 128
+
+// julianDayUnixEpoch is the julian day of the UNIX epoch, used to
+// decode INT96 timestamps
+const julianDayUnixEpoch = 2440588
+
+// FormatError describes an invalid Parquet content, which cannot be
+// opened or decoded
+type FormatError struct {
+	Err error
+}
+
+// Error is the error implementation for FormatError
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("invalid Parquet content: %v", e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+// ParseReader reads Parquet rows from given reader and calls fn for each
+// row as a map[string]interface{}, one row at a time.
+// Parquet metadata being stored at the end of the file, the content is
+// first spooled to a temporary file so that memory usage does not depend
+// on the object size.
+// Parsing stops at the first error returned by fn.
+func ParseReader(r io.Reader, fn func(row map[string]interface{}) error) error {
+	f, err := os.CreateTemp("", "influxdb-athena-crawler-*.parquet")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	size, err := io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+	return ParseFile(f, size, fn)
+}
+
+// ParseFile reads Parquet rows from given file and calls fn for each
+// row as a map[string]interface{}, one row at a time.
+// Values are typed from the Parquet physical and logical types:
+// booleans as bool, integers as int64, floating point numbers and
+// decimals as float64, byte arrays as string and timestamps / dates as
+// time.Time.
+// Null values are kept as nil.
+// Invalid contents are returned as *FormatError.
+// Parsing stops at the first error returned by fn.
+func ParseFile(r io.ReaderAt, size int64, fn func(row map[string]interface{}) error) error {
+	f, err := pq.OpenFile(r, size)
+	if err != nil {
+		return &FormatError{Err: err}
+	}
+
+	// Index leaf columns by their column index
+	schema := f.Schema()
+	columns := schema.Columns()
+	names := make([]string, len(columns))
+	nodes := make([]pq.Node, len(columns))
+	for _, path := range columns {
+		leaf, ok := schema.Lookup(path...)
+		if !ok {
+			continue
+		}
+		names[leaf.ColumnIndex] = strings.Join(path, ".")
+		nodes[leaf.ColumnIndex] = leaf.Node
+	}
+
+	buf := make([]pq.Row, rowBufferSize)
+	for _, rg := range f.RowGroups() {
+		if err := parseRowGroup(rg, buf, names, nodes, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseRowGroup reads all rows of given row group and calls fn for each
+func parseRowGroup(
+	rg pq.RowGroup,
+	buf []pq.Row,
+	names []string,
+	nodes []pq.Node,
+	fn func(row map[string]interface{}) error,
+) error {
+	rows := rg.Rows()
+	defer rows.Close()
+
+	for {
+		n, err := rows.ReadRows(buf)
+		for _, r := range buf[:n] {
+			row := make(map[string]interface{}, len(names))
+			for _, v := range r {
+				c := v.Column()
+				if v.IsNull() {
+					row[names[c]] = nil
+					continue
+				}
+				row[names[c]] = toValue(v, nodes[c])
+			}
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return &FormatError{Err: err}
+		}
+	}
+}
+
+// toValue converts a Parquet value to its Go counterpart
+func toValue(v pq.Value, node pq.Node) interface{} {
+	switch v.Kind() {
+	case pq.Boolean:
+		return v.Boolean()
+	case pq.Int32:
+		if isDate(node) {
+			return time.Unix(int64(v.Int32())*24*60*60, 0).UTC()
+		}
+		if scale, ok := decimalScale(node); ok {
+			return decimalToFloat(big.NewInt(int64(v.Int32())), scale)
+		}
+		return int64(v.Int32())
+	case pq.Int64:
+		if unit, ok := timestampUnit(node); ok {
+			return time.Unix(0, v.Int64()*int64(unit)).UTC()
+		}
+		if scale, ok := decimalScale(node); ok {
+			return decimalToFloat(big.NewInt(v.Int64()), scale)
+		}
+		return v.Int64()
+	case pq.Int96:
+		return int96ToTime(v.Int96())
+	case pq.Float:
+		return float64(v.Float())
+	case pq.Double:
+		return v.Double()
+	}
+	if scale, ok := decimalScale(node); ok {
+		return decimalToFloat(bigEndianInt(v.ByteArray()), scale)
+	}
+	return string(v.ByteArray())
+}
+
+// decimalScale returns the scale of given node if it holds decimals,
+// either from its logical or converted type
+func decimalScale(node pq.Node) (int32, bool) {
+	if lt := node.Type().LogicalType(); lt != nil && lt.Decimal != nil {
+		return lt.Decimal.Scale, true
+	}
+	return 0, false
+}
+
+// decimalToFloat converts a decimal of given unscaled value and scale to
+// the nearest float64 (e.g. 1234 with a scale of 2 becomes 12.34)
+func decimalToFloat(unscaled *big.Int, scale int32) float64 {
+	f, _ := new(big.Rat).SetFrac(unscaled, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)).Float64()
+	return f
+}
+
+// bigEndianInt returns the integer of given big-endian two's complement
+// bytes, as decimals are stored in byte arrays
+func bigEndianInt(b []byte) *big.Int {
+	i := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		i.Sub(i, new(big.Int).Lsh(big.NewInt(1), uint(len(b))*8))
+	}
+	return i
+}
+
+// isDate returns whether given node holds dates
+func isDate(node pq.Node) bool {
+	if lt := node.Type().LogicalType(); lt != nil && lt.Date != nil {
+		return true
+	}
+	ct := node.Type().ConvertedType()
+	return ct != nil && *ct == deprecated.Date
+}
+
+// timestampUnit returns the unit of given node if it holds timestamps
+func timestampUnit(node pq.Node) (time.Duration, bool) {
+	if lt := node.Type().LogicalType(); lt != nil && lt.Timestamp != nil {
+		switch {
+		case lt.Timestamp.Unit.Millis != nil:
+			return time.Millisecond, true
+		case lt.Timestamp.Unit.Micros != nil:
+			return time.Microsecond, true
+		case lt.Timestamp.Unit.Nanos != nil:
+			return time.Nanosecond, true
+		}
+	}
+	if ct := node.Type().ConvertedType(); ct != nil {
+		switch *ct {
+		case deprecated.TimestampMillis:
+			return time.Millisecond, true
+		case deprecated.TimestampMicros:
+			return time.Microsecond, true
+		}
+	}
+	return 0, false
+}
+
+// int96ToTime converts a legacy INT96 timestamp (as written by Athena /
+// Hive) to a time.Time. The first 8 bytes hold the nanoseconds of the day
+// and the last 4 bytes the julian day.
+func int96ToTime(i deprecated.Int96) time.Time {
+	nanos := int64(i[1])<<32 | int64(i[0])
+	days := int64(i[2]) - julianDayUnixEpoch
+	return time.Unix(days*24*60*60, nanos).UTC()
+}
@@ -0,0 +1,155 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	pq "github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+)
+
+type testRow struct {
+	Timestamp       time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	PublishingPoint string    `parquet:"publishing_point"`
+	Audience        int64     `parquet:"audience"`
+	Ratio           float64   `parquet:"ratio"`
+	Live            bool      `parquet:"live"`
+	Comment         *string   `parquet:"comment,optional"`
+	Price           int64     `parquet:"price,decimal(2:18)"`
+	Amount          [16]byte  `parquet:"amount,decimal(3:38)"`
+}
+
+// decimalBytes returns given unscaled decimal value as written by Athena
+// for DECIMAL(38, s) columns: big-endian two's complement bytes
+func decimalBytes(unscaled int64) [16]byte {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[8:], uint64(unscaled))
+	if unscaled < 0 {
+		binary.BigEndian.PutUint64(b[:8], math.MaxUint64)
+	}
+	return b
+}
+
+func Test_ParseReader(t *testing.T) {
+	comment := "foo"
+	ts := time.Date(2021, 6, 24, 6, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	if err := pq.Write(&buf, []testRow{
+		{Timestamp: ts, PublishingPoint: "/foo_bar_00", Audience: 6892, Ratio: 0.5, Live: true, Comment: &comment, Price: 1234, Amount: decimalBytes(56789)},
+		{Timestamp: ts, PublishingPoint: "/foo_bar_01", Audience: 7945, Ratio: 1.25, Live: false, Price: -5, Amount: decimalBytes(-1500)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:    "An invalid Parquet file should return an error",
+			data:    []byte("foo,bar\n"),
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "A valid Parquet file should be parsed with native types",
+			data: buf.Bytes(),
+			want: []map[string]interface{}{
+				{
+					"timestamp":        ts,
+					"publishing_point": "/foo_bar_00",
+					"audience":         int64(6892),
+					"ratio":            0.5,
+					"live":             true,
+					"comment":          "foo",
+					"price":            12.34,
+					"amount":           56.789,
+				},
+				{
+					"timestamp":        ts,
+					"publishing_point": "/foo_bar_01",
+					"audience":         int64(7945),
+					"ratio":            1.25,
+					"live":             false,
+					"comment":          nil,
+					"price":            -0.05,
+					"amount":           -1.5,
+				},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []map[string]interface{}
+			err := ParseReader(bytes.NewReader(tt.data), func(row map[string]interface{}) error {
+				got = append(got, row)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseReader() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var fErr *FormatError
+			if tt.wantErr && !errors.As(err, &fErr) {
+				t.Errorf("ParseReader() error = %v, want a *FormatError", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseReader() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ParseFile_callbackError(t *testing.T) {
+	errStop := errors.New("stop")
+	var buf bytes.Buffer
+	if err := pq.Write(&buf, []testRow{{}, {}, {}}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := 0
+	err := ParseFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()), func(row map[string]interface{}) error {
+		got++
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("ParseFile() error = %v, want %v", err, errStop)
+	}
+	if got != 1 {
+		t.Errorf("ParseFile() rows = %d, want 1", got)
+	}
+}
+
+func Test_int96ToTime(t *testing.T) {
+	tests := []struct {
+		name string
+		i    deprecated.Int96
+		want time.Time
+	}{
+		{
+			name: "Epoch julian day should be the UNIX epoch",
+			i:    deprecated.Int96{0, 0, julianDayUnixEpoch},
+			want: time.Unix(0, 0).UTC(),
+		},
+		{
+			name: "Nanoseconds of the day should be added",
+			i:    deprecated.Int96{uint32((6 * time.Hour) & 0xffffffff), uint32((6 * time.Hour) >> 32), julianDayUnixEpoch + 1},
+			want: time.Date(1970, 1, 2, 6, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := int96ToTime(tt.i); !got.Equal(tt.want) {
+				t.Errorf("int96ToTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
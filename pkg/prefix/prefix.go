@@ -0,0 +1,66 @@
+package prefix
+
+import (
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Data is the data prefix templates are executed with
+type Data struct {
+	// Time is the time of the expanded partition, in UTC
+	Time time.Time
+}
+
+// Date returns the partition time formatted with given layout,
+// e.g. {{.Date "2006-01-02"}}
+func (d Data) Date(layout string) string {
+	return d.Time.Format(layout)
+}
+
+// Expand expands given prefix templates for each step of the lookback
+// window ending at given time, most recent first.
+// Prefixes without template actions are returned as is, duplicated
+// prefixes are returned once.
+func Expand(prefixes []string, now time.Time, lookback, step time.Duration) ([]string, error) {
+	res := []string{}
+	seen := map[string]struct{}{}
+	for _, p := range prefixes {
+		tpl, err := template.New("prefix").Option("missingkey=error").Parse(p)
+		if err != nil {
+			return nil, err
+		}
+
+		for d := time.Duration(0); d <= lookback; d += step {
+			var b strings.Builder
+			if err := tpl.Execute(&b, Data{Time: now.Add(-d).UTC()}); err != nil {
+				return nil, err
+			}
+			if _, ok := seen[b.String()]; !ok {
+				seen[b.String()] = struct{}{}
+				res = append(res, b.String())
+			}
+			// Stop at first iteration for static prefixes
+			if !strings.Contains(p, "{{") {
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+// Static returns the static part of given prefix templates, before their
+// first template action, which keys of any of their partitions start with.
+// Duplicated prefixes are returned once.
+func Static(prefixes []string) []string {
+	res := []string{}
+	seen := map[string]struct{}{}
+	for _, p := range prefixes {
+		p, _, _ = strings.Cut(p, "{{")
+		if _, ok := seen[p]; !ok {
+			seen[p] = struct{}{}
+			res = append(res, p)
+		}
+	}
+	return res
+}
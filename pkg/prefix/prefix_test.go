@@ -0,0 +1,132 @@
+package prefix
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_Expand(t *testing.T) {
+	now := time.Date(2024, 3, 2, 13, 30, 0, 0, time.UTC)
+	type args struct {
+		prefixes []string
+		lookback time.Duration
+		step     time.Duration
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "Static prefixes should be returned as is",
+			args: args{
+				prefixes: []string{"foo/", "bar/", "foo/"},
+				lookback: 72 * time.Hour,
+				step:     24 * time.Hour,
+			},
+			want:    []string{"foo/", "bar/"},
+			wantErr: false,
+		},
+		{
+			name: "Date templates should be expanded over the lookback window",
+			args: args{
+				prefixes: []string{`reports/dt={{.Date "2006-01-02"}}/`},
+				lookback: 72 * time.Hour,
+				step:     24 * time.Hour,
+			},
+			want: []string{
+				"reports/dt=2024-03-02/",
+				"reports/dt=2024-03-01/",
+				"reports/dt=2024-02-29/",
+				"reports/dt=2024-02-28/",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Hourly partitions should be expanded with hourly steps",
+			args: args{
+				prefixes: []string{`reports/dt={{.Date "2006-01-02"}}/hour={{.Date "15"}}/`},
+				lookback: 2 * time.Hour,
+				step:     time.Hour,
+			},
+			want: []string{
+				"reports/dt=2024-03-02/hour=13/",
+				"reports/dt=2024-03-02/hour=12/",
+				"reports/dt=2024-03-02/hour=11/",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Without lookback only the current partition should be returned",
+			args: args{
+				prefixes: []string{`reports/dt={{.Date "2006-01-02"}}/`},
+				step:     24 * time.Hour,
+			},
+			want:    []string{"reports/dt=2024-03-02/"},
+			wantErr: false,
+		},
+		{
+			name: "Invalid template should return an error",
+			args: args{
+				prefixes: []string{`reports/dt={{.Date "2006-01-02"/`},
+				step:     24 * time.Hour,
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "Unknown template field should return an error",
+			args: args{
+				prefixes: []string{`reports/dt={{.Foo}}/`},
+				step:     24 * time.Hour,
+			},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand(tt.args.prefixes, now, tt.args.lookback, tt.args.step)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Static(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefixes []string
+		want     []string
+	}{
+		{
+			name:     "Static prefixes should be returned as is",
+			prefixes: []string{"foo/", "bar/"},
+			want:     []string{"foo/", "bar/"},
+		},
+		{
+			name:     "Templates should be cut before their first action",
+			prefixes: []string{`reports/dt={{.Date "2006-01-02"}}/hour={{.Date "15"}}/`},
+			want:     []string{"reports/dt="},
+		},
+		{
+			name:     "Duplicated prefixes should be returned once",
+			prefixes: []string{`reports/dt={{.Date "2006-01-02"}}/`, "reports/dt=", `{{.Date "2006"}}/`},
+			want:     []string{"reports/dt=", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Static(tt.prefixes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Static() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package quarantine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+)
+
+// ErrorSuffix is appended to quarantined objects keys for their error
+// sidecar key
+const ErrorSuffix = ".error.json"
+
+// Error describes an invalid object content, objects failing with such
+// errors are quarantined instead of being retried
+type Error struct {
+	Err error
+	// Line and Column locate the error in the object, if known
+	Line, Column int
+	// Row is the number of the data row (starting at 1) which could not
+	// be converted to a point, if any
+	Row int64
+	// Field is the row column which could not be converted, if any
+	Field string
+	// WrittenPoints is how many points of the object were written to
+	// InfluxDB before the error
+	WrittenPoints int64
+}
+
+// Error is the error implementation for Error
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Report is the content of error sidecars
+type Report struct {
+	Object        string    `json:"object"`
+	Error         string    `json:"error"`
+	Line          int       `json:"line,omitempty"`
+	Column        int       `json:"column,omitempty"`
+	Row           int64     `json:"row,omitempty"`
+	Field         string    `json:"field,omitempty"`
+	WrittenPoints int64     `json:"written_points,omitempty"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// NewReport returns the report of given error for the object with given key
+func NewReport(key string, err error) *Report {
+	r := &Report{
+		Object:        key,
+		Error:         err.Error(),
+		QuarantinedAt: time.Now().UTC(),
+	}
+	var qErr *Error
+	if errors.As(err, &qErr) {
+		r.Line = qErr.Line
+		r.Column = qErr.Column
+		r.Row = qErr.Row
+		r.Field = qErr.Field
+		r.WrittenPoints = qErr.WrittenPoints
+	}
+	return r
+}
+
+// Move moves given object under given prefix of the same store, keeping
+// its key, and writes an error sidecar describing given error next to it.
+// It returns the quarantined object key.
+func Move(ctx context.Context, objStore store.ObjectStore, o store.Object, prefix string, err error) (string, error) {
+	qKey := prefix + o.Key
+	if err := store.Copy(ctx, objStore, o, objStore, qKey, ""); err != nil {
+		return "", fmt.Errorf("failed to copy object: %w", err)
+	}
+
+	b, err := json.Marshal(NewReport(o.Key, err))
+	if err != nil {
+		return "", err
+	}
+	if err := objStore.Put(ctx, qKey+ErrorSuffix, bytes.NewReader(append(b, '\n'))); err != nil {
+		return "", fmt.Errorf("failed to write error sidecar: %w", err)
+	}
+
+	if err := objStore.Delete(ctx, o.Key); err != nil {
+		return "", fmt.Errorf("failed to delete object: %w", err)
+	}
+	return qKey, nil
+}
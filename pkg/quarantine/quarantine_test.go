@@ -0,0 +1,88 @@
+package quarantine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+)
+
+func TestMove(t *testing.T) {
+	ctx := context.Background()
+	objStore := store.NewLocal(t.TempDir())
+	if err := objStore.Put(ctx, "foo/bar.csv", strings.NewReader("baz")); err != nil {
+		t.Fatal(err)
+	}
+
+	err := fmt.Errorf("failed to parse: %w", &Error{Err: errors.New("bad quote"), Line: 3, Column: 7})
+	qKey, err := Move(ctx, objStore, store.Object{Key: "foo/bar.csv", Size: 3}, "quarantine/", err)
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	if qKey != "quarantine/foo/bar.csv" {
+		t.Errorf("Move() key = %q, want %q", qKey, "quarantine/foo/bar.csv")
+	}
+
+	objs, err := objStore.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{}
+	for _, o := range objs {
+		keys = append(keys, o.Key)
+	}
+	want := []string{"quarantine/foo/bar.csv", "quarantine/foo/bar.csv.error.json"}
+	if strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Errorf("Move() objects = %v, want %v", keys, want)
+	}
+
+	r, err := objStore.Get(ctx, "quarantine/foo/bar.csv.error.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var report Report
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		t.Fatalf("error sidecar decoding error = %v", err)
+	}
+	if report.Object != "foo/bar.csv" || report.Error != "failed to parse: bad quote" || report.Line != 3 || report.Column != 7 {
+		t.Errorf("error sidecar = %+v", report)
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Report
+	}{
+		{
+			name: "Plain errors should only be described",
+			err:  errors.New("foo"),
+			want: Report{Object: "key", Error: "foo"},
+		},
+		{
+			name: "Conversion errors should be located",
+			err:  &Error{Err: errors.New("foo"), Row: 12, Field: "bar"},
+			want: Report{Object: "key", Error: "foo", Row: 12, Field: "bar"},
+		},
+		{
+			name: "Written points should be recorded",
+			err:  &Error{Err: errors.New("foo"), Line: 13, Row: 12, Field: "bar", WrittenPoints: 5000},
+			want: Report{Object: "key", Error: "foo", Line: 13, Row: 12, Field: "bar", WrittenPoints: 5000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewReport("key", tt.err)
+			got.QuarantinedAt = tt.want.QuarantinedAt
+			if *got != tt.want {
+				t.Errorf("NewReport() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
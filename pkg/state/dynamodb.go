@@ -0,0 +1,119 @@
+package state
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+)
+
+// DynamoDB table attributes, the table partition key must be a string
+// named after DynamoDBKeyAttribute
+const (
+	DynamoDBKeyAttribute         = "object_key"
+	dynamoDBProcessedAtAttribute = "processed_at"
+	dynamoDBRecordAttribute      = "record"
+)
+
+// DynamoDBClient is the subset of the DynamoDB API used to store states,
+// it is implemented by *dynamodb.Client
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// dynamoDB is the Store implementation relying on a DynamoDB table
+type dynamoDB struct {
+	cli       DynamoDBClient
+	table     string
+	namespace string
+}
+
+// NewDynamoDB returns a Store implementation relying on given DynamoDB
+// table. States keys are prefixed with given namespace (e.g. the bucket)
+// so that a table can be shared between crawlers.
+func NewDynamoDB(cli DynamoDBClient, table, namespace string) Store {
+	return &dynamoDB{
+		cli:       cli,
+		table:     table,
+		namespace: namespace,
+	}
+}
+
+// key returns the item key for given data object key
+func (d *dynamoDB) key(key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		DynamoDBKeyAttribute: &types.AttributeValueMemberS{Value: d.namespace + "/" + key},
+	}
+}
+
+// Load is the Store Load implementation for DynamoDB, states are not
+// held in listed objects
+func (d *dynamoDB) Load(_ context.Context, _ []store.Object) error {
+	return nil
+}
+
+// Processed is the Store Processed implementation for DynamoDB
+func (d *dynamoDB) Processed(ctx context.Context, o store.Object) (bool, error) {
+	return processed(ctx, d, o)
+}
+
+// Record is the Store Record implementation for DynamoDB
+func (d *dynamoDB) Record(ctx context.Context, o store.Object) (*Record, error) {
+	out, err := d.cli.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(d.table),
+		Key:            d.key(o.Key),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || len(out.Item) == 0 {
+		return nil, err
+	}
+	if v, ok := out.Item[dynamoDBRecordAttribute].(*types.AttributeValueMemberS); ok {
+		return ReadRecord(strings.NewReader(v.Value))
+	}
+	return &Record{}, nil
+}
+
+// MarkProcessed is the Store MarkProcessed implementation for DynamoDB,
+// the record being stored as a JSON attribute
+func (d *dynamoDB) MarkProcessed(ctx context.Context, o store.Object, rec *Record) error {
+	b, err := rec.marshal()
+	if err != nil {
+		return err
+	}
+	item := d.key(o.Key)
+	item[dynamoDBProcessedAtAttribute] = &types.AttributeValueMemberS{
+		Value: rec.ProcessedAt.UTC().Format(time.RFC3339),
+	}
+	item[dynamoDBRecordAttribute] = &types.AttributeValueMemberS{Value: string(b)}
+	_, err = d.cli.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.table),
+		Item:      item,
+	})
+	return err
+}
+
+// Delete is the Store Delete implementation for DynamoDB
+func (d *dynamoDB) Delete(ctx context.Context, key string) error {
+	_, err := d.cli.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.table),
+		Key:       d.key(key),
+	})
+	return err
+}
+
+// Orphans is the Store Orphans implementation for DynamoDB, states are
+// deleted along with data objects
+func (d *dynamoDB) Orphans(_ context.Context) ([]store.Object, error) {
+	return nil, nil
+}
+
+// Close is the Store Close implementation for DynamoDB
+func (d *dynamoDB) Close() error {
+	return nil
+}
@@ -0,0 +1,76 @@
+package state
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+)
+
+// fakeDynamoDBClient is an in memory DynamoDBClient implementation
+type fakeDynamoDBClient struct {
+	mu    sync.Mutex
+	items map[string]map[string]types.AttributeValue
+}
+
+func itemKey(key map[string]types.AttributeValue) string {
+	return key[DynamoDBKeyAttribute].(*types.AttributeValueMemberS).Value
+}
+
+func (c *fakeDynamoDBClient) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &dynamodb.GetItemOutput{Item: c.items[itemKey(params.Key)]}, nil
+}
+
+func (c *fakeDynamoDBClient) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[itemKey(params.Item)] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (c *fakeDynamoDBClient) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, itemKey(params.Key))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func Test_dynamoDB(t *testing.T) {
+	ctx := context.Background()
+	cli := &fakeDynamoDBClient{items: map[string]map[string]types.AttributeValue{}}
+	s := NewDynamoDB(cli, "table", "bucket")
+	o := store.Object{Key: "foo/bar.csv"}
+	rec := &Record{Rows: 1, Points: 1, ProcessedAt: time.Date(2021, 6, 24, 6, 0, 0, 0, time.UTC)}
+
+	if ok, err := s.Processed(ctx, o); err != nil || ok {
+		t.Errorf("dynamoDB.Processed() = %v, %v, want false, nil", ok, err)
+	}
+	if err := s.MarkProcessed(ctx, o, rec); err != nil {
+		t.Fatalf("dynamoDB.MarkProcessed() error = %v", err)
+	}
+	if _, ok := cli.items["bucket/foo/bar.csv"]; !ok {
+		t.Errorf("dynamoDB.MarkProcessed() items = %v", cli.items)
+	}
+	if ok, err := s.Processed(ctx, o); err != nil || !ok {
+		t.Errorf("dynamoDB.Processed() = %v, %v, want true, nil", ok, err)
+	}
+	if got, err := s.Record(ctx, o); err != nil || !reflect.DeepEqual(got, rec) {
+		t.Errorf("dynamoDB.Record() = %+v, %v, want %+v, nil", got, err, rec)
+	}
+	if err := s.Delete(ctx, o.Key); err != nil {
+		t.Fatalf("dynamoDB.Delete() error = %v", err)
+	}
+	if got, err := s.Record(ctx, o); err != nil || got != nil {
+		t.Errorf("dynamoDB.Record() after Delete = %+v, %v, want nil, nil", got, err)
+	}
+	if ok, err := s.Processed(ctx, o); err != nil || ok {
+		t.Errorf("dynamoDB.Processed() after Delete = %v, %v, want false, nil", ok, err)
+	}
+}
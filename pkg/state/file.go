@@ -0,0 +1,103 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+// fileBucket is the bbolt bucket holding processing states
+var fileBucket = []byte("processed")
+
+// file is the Store implementation relying on a local embedded
+// key-value file
+type file struct {
+	db        *bolt.DB
+	namespace string
+}
+
+// NewFile returns a Store implementation relying on a local embedded
+// key-value file at given path, created if missing.
+// States keys are prefixed with given namespace (e.g. the bucket) so
+// that a file can be shared between crawlers.
+func NewFile(path, namespace string) (Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(fileBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &file{
+		db:        db,
+		namespace: namespace,
+	}, nil
+}
+
+// key returns the state key for given data object key
+func (f *file) key(key string) []byte {
+	return []byte(f.namespace + "/" + key)
+}
+
+// Load is the Store Load implementation for file, states are not held
+// in listed objects
+func (f *file) Load(_ context.Context, _ []store.Object) error {
+	return nil
+}
+
+// Processed is the Store Processed implementation for file
+func (f *file) Processed(ctx context.Context, o store.Object) (bool, error) {
+	return processed(ctx, f, o)
+}
+
+// Record is the Store Record implementation for file
+func (f *file) Record(_ context.Context, o store.Object) (*Record, error) {
+	var b []byte
+	err := f.db.View(func(tx *bolt.Tx) error {
+		// Values are only valid during the transaction
+		if v := tx.Bucket(fileBucket).Get(f.key(o.Key)); v != nil {
+			b = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return ReadRecord(bytes.NewReader(b))
+}
+
+// MarkProcessed is the Store MarkProcessed implementation for file
+func (f *file) MarkProcessed(_ context.Context, o store.Object, rec *Record) error {
+	b, err := rec.marshal()
+	if err != nil {
+		return err
+	}
+	return f.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(fileBucket).Put(f.key(o.Key), b)
+	})
+}
+
+// Delete is the Store Delete implementation for file
+func (f *file) Delete(_ context.Context, key string) error {
+	return f.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(fileBucket).Delete(f.key(key))
+	})
+}
+
+// Orphans is the Store Orphans implementation for file, states are
+// deleted along with data objects
+func (f *file) Orphans(_ context.Context) ([]store.Object, error) {
+	return nil, nil
+}
+
+// Close is the Store Close implementation for file
+func (f *file) Close() error {
+	return f.db.Close()
+}
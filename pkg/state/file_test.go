@@ -0,0 +1,79 @@
+package state
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+)
+
+func Test_file(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+	o := store.Object{Key: "foo/bar.csv"}
+	rec := &Record{Rows: 1, Points: 1, ProcessedAt: time.Date(2021, 6, 24, 6, 0, 0, 0, time.UTC)}
+
+	s, err := NewFile(path, "bucket")
+	if err != nil {
+		t.Fatalf("NewFile() error = %v", err)
+	}
+	if ok, err := s.Processed(ctx, o); err != nil || ok {
+		t.Errorf("file.Processed() = %v, %v, want false, nil", ok, err)
+	}
+	if err := s.MarkProcessed(ctx, o, rec); err != nil {
+		t.Fatalf("file.MarkProcessed() error = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("file.Close() error = %v", err)
+	}
+
+	// States should persist across reopening and be namespaced
+	s, err = NewFile(path, "bucket")
+	if err != nil {
+		t.Fatalf("NewFile() error = %v", err)
+	}
+	if ok, err := s.Processed(ctx, o); err != nil || !ok {
+		t.Errorf("file.Processed() = %v, %v, want true, nil", ok, err)
+	}
+	if got, err := s.Record(ctx, o); err != nil || !reflect.DeepEqual(got, rec) {
+		t.Errorf("file.Record() = %+v, %v, want %+v, nil", got, err, rec)
+	}
+	changed := o
+	changed.ETag = "foo"
+	changed.LastModified = rec.ProcessedAt
+	rec.ETag = "bar"
+	if err := s.MarkProcessed(ctx, o, rec); err != nil {
+		t.Fatalf("file.MarkProcessed() error = %v", err)
+	}
+	if ok, err := s.Processed(ctx, changed); err != nil || ok {
+		t.Errorf("file.Processed() with changed ETag = %v, %v, want false, nil", ok, err)
+	}
+	if err := s.MarkProcessed(ctx, o, &Record{Partial: true}); err != nil {
+		t.Fatalf("file.MarkProcessed() error = %v", err)
+	}
+	if ok, err := s.Processed(ctx, o); err != nil || ok {
+		t.Errorf("file.Processed() with partial record = %v, %v, want false, nil", ok, err)
+	}
+	if err := s.Delete(ctx, o.Key); err != nil {
+		t.Fatalf("file.Delete() error = %v", err)
+	}
+	if ok, err := s.Processed(ctx, o); err != nil || ok {
+		t.Errorf("file.Processed() after Delete = %v, %v, want false, nil", ok, err)
+	}
+	if err := s.MarkProcessed(ctx, o, rec); err != nil {
+		t.Fatalf("file.MarkProcessed() error = %v", err)
+	}
+	s.Close()
+
+	s, err = NewFile(path, "other")
+	if err != nil {
+		t.Fatalf("NewFile() error = %v", err)
+	}
+	defer s.Close()
+	if ok, err := s.Processed(ctx, o); err != nil || ok {
+		t.Errorf("file.Processed() in other namespace = %v, %v, want false, nil", ok, err)
+	}
+}
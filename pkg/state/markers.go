@@ -0,0 +1,196 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+)
+
+// PartialSuffix is appended to markers keys for objects which have not
+// been written to all InfluxDB servers yet
+const PartialSuffix = ".partial"
+
+// IsMarkerKey returns whether given key is the one of a marker with given
+// processed flag suffix, complete or partial
+func IsMarkerKey(key, flagSuffix string) bool {
+	return strings.HasSuffix(key, flagSuffix) || strings.HasSuffix(key, flagSuffix+PartialSuffix)
+}
+
+// markers is the Store implementation relying on marker objects written
+// next to data objects, their key being the data object one with the
+// processed flag suffix instead of the data suffix.
+// Partial records are written to a distinct marker so that complete
+// markers can be told from the listing only.
+type markers struct {
+	objStore           store.ObjectStore
+	suffix, flagSuffix string
+
+	// Loaded listing index, read only once loaded
+	listed  map[string]struct{}
+	flags   map[string]store.Object
+	orphans []store.Object
+}
+
+// NewMarkers returns a Store implementation relying on marker objects
+func NewMarkers(objStore store.ObjectStore, suffix, flagSuffix string) Store {
+	return &markers{
+		objStore:   objStore,
+		suffix:     suffix,
+		flagSuffix: flagSuffix,
+	}
+}
+
+// markerKey returns the marker key for given data object key
+func (m *markers) markerKey(key string) string {
+	stem, _ := KeyStem(key, m.suffix)
+	return stem + m.flagSuffix
+}
+
+// markerStem returns the data object key stem of given marker key
+func (m *markers) markerStem(key string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(key, PartialSuffix), m.flagSuffix)
+}
+
+// Load is the Store Load implementation for markers.
+// All keys are indexed at once so that data objects and markers are
+// matched regardless of the order (or listing page) in which they appear.
+func (m *markers) Load(_ context.Context, listed []store.Object) error {
+	m.listed = make(map[string]struct{}, len(listed))
+	m.flags = make(map[string]store.Object)
+	stems := make(map[string]struct{})
+	for _, o := range listed {
+		m.listed[o.Key] = struct{}{}
+		if IsMarkerKey(o.Key, m.flagSuffix) {
+			m.flags[o.Key] = o
+		} else if stem, ok := KeyStem(o.Key, m.suffix); ok {
+			stems[stem] = struct{}{}
+		}
+	}
+
+	// Markers that do not match any data object are orphans, this can
+	// happen if the crawler was interrupted
+	m.orphans = []store.Object{}
+	for _, o := range listed {
+		if !IsMarkerKey(o.Key, m.flagSuffix) {
+			continue
+		}
+		if _, ok := stems[m.markerStem(o.Key)]; !ok {
+			m.orphans = append(m.orphans, o)
+		}
+	}
+	return nil
+}
+
+// marker returns the marker object with given key for given data object,
+// the boolean is false if it does not exist
+func (m *markers) marker(ctx context.Context, o store.Object, key string) (store.Object, bool, error) {
+	if _, ok := m.listed[o.Key]; ok {
+		marker, ok := m.flags[key]
+		return marker, ok, nil
+	}
+
+	// Object out of the loaded listing, look its marker up
+	return store.Find(ctx, m.objStore, key)
+}
+
+// Processed is the Store Processed implementation for markers.
+// Markers written after the last modification of their data object are
+// current, others are read to compare the recorded ETag.
+func (m *markers) Processed(ctx context.Context, o store.Object) (bool, error) {
+	marker, ok, err := m.marker(ctx, o, m.markerKey(o.Key))
+	if err != nil || !ok {
+		return false, err
+	}
+	if !marker.LastModified.Before(o.LastModified) {
+		return true, nil
+	}
+
+	rec, err := m.read(ctx, marker.Key)
+	if err != nil {
+		return false, err
+	}
+	return Current(rec, o), nil
+}
+
+// Record is the Store Record implementation for markers, reading the
+// complete marker content, or the partial one if there is none or if
+// only the partial one is current (e.g. a rewrite of an overwritten
+// object reached some servers only)
+func (m *markers) Record(ctx context.Context, o store.Object) (*Record, error) {
+	var res *Record
+	for _, key := range []string{m.markerKey(o.Key), m.markerKey(o.Key) + PartialSuffix} {
+		marker, ok, err := m.marker(ctx, o, key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		rec, err := m.read(ctx, marker.Key)
+		if err != nil {
+			return nil, err
+		}
+		if Current(rec, o) {
+			return rec, nil
+		}
+		if res == nil {
+			res = rec
+		}
+	}
+	return res, nil
+}
+
+// read reads the record of the marker with given key
+func (m *markers) read(ctx context.Context, key string) (*Record, error) {
+	r, err := m.objStore.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ReadRecord(r)
+}
+
+// MarkProcessed is the Store MarkProcessed implementation for markers,
+// the record being written as the marker content
+func (m *markers) MarkProcessed(ctx context.Context, o store.Object, rec *Record) error {
+	b, err := rec.marshal()
+	if err != nil {
+		return err
+	}
+	key, obsolete := m.markerKey(o.Key), m.markerKey(o.Key)+PartialSuffix
+	if rec.Partial {
+		key, obsolete = obsolete, key
+	}
+	if err := m.objStore.Put(ctx, key, bytes.NewReader(b)); err != nil {
+		return err
+	}
+
+	// The other marker, if any, is now obsolete: a partial one once
+	// complete, or a complete one of a previous version of the object
+	if _, ok := m.listed[o.Key]; ok {
+		if _, ok := m.flags[obsolete]; !ok {
+			return nil
+		}
+	}
+	return m.objStore.Delete(ctx, obsolete)
+}
+
+// Delete is the Store Delete implementation for markers
+func (m *markers) Delete(ctx context.Context, key string) error {
+	if err := m.objStore.Delete(ctx, m.markerKey(key)); err != nil {
+		return err
+	}
+	return m.objStore.Delete(ctx, m.markerKey(key)+PartialSuffix)
+}
+
+// Orphans is the Store Orphans implementation for markers
+func (m *markers) Orphans(_ context.Context) ([]store.Object, error) {
+	return m.orphans, nil
+}
+
+// Close is the Store Close implementation for markers
+func (m *markers) Close() error {
+	return nil
+}
@@ -0,0 +1,200 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+)
+
+func Test_markers(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	for _, k := range []string{"foo/a.csv", "foo/a.processed", "foo/b.csv.gz", "foo/c.processed"} {
+		path := filepath.Join(root, filepath.FromSlash(k))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(k), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objStore := store.NewLocal(root)
+	listed, err := objStore.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewMarkers(objStore, ".csv", ".processed")
+	if err := s.Load(ctx, listed); err != nil {
+		t.Fatalf("markers.Load() error = %v", err)
+	}
+
+	orphans, err := s.Orphans(ctx)
+	if err != nil {
+		t.Fatalf("markers.Orphans() error = %v", err)
+	}
+	keys := []string{}
+	for _, o := range orphans {
+		keys = append(keys, o.Key)
+	}
+	if want := []string{"foo/c.processed"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("markers.Orphans() = %v, want %v", keys, want)
+	}
+
+	for key, want := range map[string]bool{
+		"foo/a.csv":    true,
+		"foo/b.csv.gz": false,
+		// Out of the loaded listing, looked up in the object store
+		"foo/c.csv": true,
+		"bar/d.csv": false,
+	} {
+		got, err := s.Processed(ctx, store.Object{Key: key})
+		if err != nil {
+			t.Fatalf("markers.Processed(%q) error = %v", key, err)
+		}
+		if got != want {
+			t.Errorf("markers.Processed(%q) = %v, want %v", key, got, want)
+		}
+	}
+
+	// Marking and deleting objects out of the loaded listing should be
+	// reflected in the object store
+	o := store.Object{Key: "bar/d.csv"}
+	rec := &Record{Rows: 1, Points: 1, ProcessedAt: time.Date(2021, 6, 24, 6, 0, 0, 0, time.UTC)}
+	if err := s.MarkProcessed(ctx, o, rec); err != nil {
+		t.Fatalf("markers.MarkProcessed() error = %v", err)
+	}
+	if ok, _ := s.Processed(ctx, o); !ok {
+		t.Errorf("markers.Processed() = false after MarkProcessed")
+	}
+	if _, err := os.Stat(filepath.Join(root, "bar", "d.processed")); err != nil {
+		t.Errorf("marker should be written: %v", err)
+	}
+	if got, err := s.Record(ctx, o); err != nil || !reflect.DeepEqual(got, rec) {
+		t.Errorf("markers.Record() = %+v, %v, want %+v, nil", got, err, rec)
+	}
+	if err := s.Delete(ctx, o.Key); err != nil {
+		t.Fatalf("markers.Delete() error = %v", err)
+	}
+	if ok, _ := s.Processed(ctx, o); ok {
+		t.Errorf("markers.Processed() = true after Delete")
+	}
+	if got, err := s.Record(ctx, o); err != nil || got != nil {
+		t.Errorf("markers.Record() after Delete = %+v, %v, want nil, nil", got, err)
+	}
+
+	// Objects modified after their marker should be compared to the
+	// recorded version
+	o = store.Object{Key: "bar/e.csv", ETag: "foo", LastModified: time.Now().Add(time.Hour)}
+	if err := s.MarkProcessed(ctx, o, &Record{ETag: "foo"}); err != nil {
+		t.Fatalf("markers.MarkProcessed() error = %v", err)
+	}
+	if ok, err := s.Processed(ctx, o); err != nil || !ok {
+		t.Errorf("markers.Processed() with same ETag = %v, %v, want true, nil", ok, err)
+	}
+	o.ETag = "bar"
+	if ok, err := s.Processed(ctx, o); err != nil || ok {
+		t.Errorf("markers.Processed() with changed ETag = %v, %v, want false, nil", ok, err)
+	}
+	o.LastModified = time.Time{}
+	if ok, err := s.Processed(ctx, o); err != nil || !ok {
+		t.Errorf("markers.Processed() written after modification = %v, %v, want true, nil", ok, err)
+	}
+}
+
+func Test_markers_partial(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	objStore := store.NewLocal(root)
+	s := NewMarkers(objStore, ".csv", ".processed")
+	o := store.Object{Key: "foo/a.csv"}
+
+	partial := &Record{InfluxServers: []string{"a"}, Partial: true}
+	if err := s.MarkProcessed(ctx, o, partial); err != nil {
+		t.Fatalf("markers.MarkProcessed() error = %v", err)
+	}
+	if ok, err := s.Processed(ctx, o); err != nil || ok {
+		t.Errorf("markers.Processed() with partial record = %v, %v, want false, nil", ok, err)
+	}
+	if got, err := s.Record(ctx, o); err != nil || !reflect.DeepEqual(got, partial) {
+		t.Errorf("markers.Record() = %+v, %v, want %+v, nil", got, err, partial)
+	}
+
+	// Partial markers without data object should be orphans
+	listed, err := objStore.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(ctx, listed); err != nil {
+		t.Fatalf("markers.Load() error = %v", err)
+	}
+	if orphans, _ := s.Orphans(ctx); len(orphans) != 1 || orphans[0].Key != "foo/a.processed.partial" {
+		t.Errorf("markers.Orphans() = %v, want [foo/a.processed.partial]", orphans)
+	}
+
+	complete := &Record{InfluxServers: []string{"a", "b"}}
+	if err := s.MarkProcessed(ctx, o, complete); err != nil {
+		t.Fatalf("markers.MarkProcessed() error = %v", err)
+	}
+	if ok, err := s.Processed(ctx, o); err != nil || !ok {
+		t.Errorf("markers.Processed() with complete record = %v, %v, want true, nil", ok, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "foo", "a.processed.partial")); !os.IsNotExist(err) {
+		t.Errorf("partial marker should be deleted, got %v", err)
+	}
+}
+
+func Test_markers_partialRewrite(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	objStore := store.NewLocal(root)
+	s := NewMarkers(objStore, ".csv", ".processed")
+
+	// The object is fully processed, then overwritten and written again
+	// to some servers only
+	o := store.Object{Key: "foo/a.csv", ETag: "e1"}
+	complete := &Record{ETag: "e1", InfluxServers: []string{"a", "b"}}
+	if err := s.MarkProcessed(ctx, o, complete); err != nil {
+		t.Fatalf("markers.MarkProcessed() error = %v", err)
+	}
+	o.ETag, o.LastModified = "e2", time.Now().Add(time.Hour)
+	partial := &Record{ETag: "e2", InfluxServers: []string{"a"}, Partial: true}
+	if err := s.MarkProcessed(ctx, o, partial); err != nil {
+		t.Fatalf("markers.MarkProcessed() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "foo", "a.processed")); !os.IsNotExist(err) {
+		t.Errorf("stale complete marker should be deleted, got %v", err)
+	}
+	if got, err := s.Record(ctx, o); err != nil || !reflect.DeepEqual(got, partial) {
+		t.Errorf("markers.Record() = %+v, %v, want %+v, nil", got, err, partial)
+	}
+
+	// A stale complete marker left over should not hide the current
+	// partial record
+	b, err := complete.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := objStore.Put(ctx, "foo/a.processed", bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Record(ctx, o); err != nil || !reflect.DeepEqual(got, partial) {
+		t.Errorf("markers.Record() with stale complete marker = %+v, %v, want %+v, nil", got, err, partial)
+	}
+	if ok, err := s.Processed(ctx, o); err != nil || ok {
+		t.Errorf("markers.Processed() = %v, %v, want false, nil", ok, err)
+	}
+
+	// Without current record, the complete one is the previous version
+	o.ETag = "e3"
+	if got, err := s.Record(ctx, o); err != nil || !reflect.DeepEqual(got, complete) {
+		t.Errorf("markers.Record() of a new version = %+v, %v, want %+v, nil", got, err, complete)
+	}
+}
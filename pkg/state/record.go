@@ -0,0 +1,62 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Record describes the processing of a data object, it is the content of
+// processed markers
+type Record struct {
+	// Source object
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	Size         int64     `json:"size"`
+
+	// Written points
+	Rows         int64 `json:"rows"`
+	Points       int64 `json:"points"`
+	RejectedRows int64 `json:"rejected_rows"`
+	// SkippedRows are ragged rows skipped, not counted in Rows
+	SkippedRows   int64    `json:"skipped_rows,omitempty"`
+	InfluxServers []string `json:"influx_servers,omitempty"`
+	// Partial is true if some InfluxDB servers are still missing the
+	// object, only InfluxServers have it
+	Partial      bool       `json:"partial,omitempty"`
+	Measurement  string     `json:"measurement,omitempty"`
+	MinTimestamp *time.Time `json:"min_timestamp,omitempty"`
+	MaxTimestamp *time.Time `json:"max_timestamp,omitempty"`
+
+	CrawlerVersion string    `json:"crawler_version,omitempty"`
+	ProcessedAt    time.Time `json:"processed_at"`
+}
+
+// ReadRecord reads a Record from given marker content.
+// Legacy markers holding a single 0 byte (or nothing) are valid, an empty
+// Record is returned for them.
+func ReadRecord(r io.Reader) (*Record, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.Trim(b, "\x00")) == 0 {
+		return &Record{}, nil
+	}
+
+	var rec Record
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// marshal returns the JSON encoding of the Record
+func (r *Record) marshal() ([]byte, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
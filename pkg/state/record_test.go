@@ -0,0 +1,79 @@
+package state
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadRecord(t *testing.T) {
+	min := time.Date(2021, 6, 24, 6, 0, 0, 0, time.UTC)
+	max := time.Date(2021, 6, 24, 7, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		content string
+		want    *Record
+		wantErr bool
+	}{
+		{
+			name:    "Legacy marker should return an empty record",
+			content: "\x00",
+			want:    &Record{},
+		},
+		{
+			name:    "Empty marker should return an empty record",
+			content: "",
+			want:    &Record{},
+		},
+		{
+			name:    "JSON marker should be read",
+			content: `{"etag":"foo","size":12,"rows":3,"points":2,"rejected_rows":1,"influx_servers":["http://localhost:8086"],"measurement":"bar","min_timestamp":"2021-06-24T06:00:00Z","max_timestamp":"2021-06-24T07:00:00Z","crawler_version":"1.0.0","processed_at":"2021-06-24T08:00:00Z"}`,
+			want: &Record{
+				ETag:           "foo",
+				Size:           12,
+				Rows:           3,
+				Points:         2,
+				RejectedRows:   1,
+				InfluxServers:  []string{"http://localhost:8086"},
+				Measurement:    "bar",
+				MinTimestamp:   &min,
+				MaxTimestamp:   &max,
+				CrawlerVersion: "1.0.0",
+				ProcessedAt:    time.Date(2021, 6, 24, 8, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "Invalid marker should return an error",
+			content: "foo",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadRecord(strings.NewReader(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadRecord() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadRecord() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecord_marshal(t *testing.T) {
+	ts := time.Date(2021, 6, 24, 6, 0, 0, 0, time.UTC)
+	rec := &Record{ETag: "foo", Rows: 1, Points: 1, MinTimestamp: &ts, MaxTimestamp: &ts, ProcessedAt: ts}
+	b, err := rec.marshal()
+	if err != nil {
+		t.Fatalf("Record.marshal() error = %v", err)
+	}
+	got, err := ReadRecord(strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatalf("ReadRecord() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, rec) {
+		t.Errorf("ReadRecord() = %+v, want %+v", got, rec)
+	}
+}
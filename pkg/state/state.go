@@ -0,0 +1,72 @@
+package state
+
+import (
+	"context"
+	"strings"
+
+	"github.com/quortex/influxdb-athena-crawler/pkg/compress"
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+)
+
+// Store describes what a processing state store should do.
+// Processing states are identified by data objects keys.
+type Store interface {
+	// Load prepares the store with the whole listing of the crawled
+	// prefixes. Stores holding their states in listed objects rely on it
+	// to avoid a lookup per object, others ignore it.
+	Load(ctx context.Context, listed []store.Object) error
+	// Processed returns whether given data object has been fully
+	// processed in its current version, see Current
+	Processed(ctx context.Context, o store.Object) (bool, error)
+	// Record returns the processing record of given data object, nil
+	// if it has not been processed. The record may be a partial one.
+	Record(ctx context.Context, o store.Object) (*Record, error)
+	// MarkProcessed records given data object as processed
+	MarkProcessed(ctx context.Context, o store.Object, rec *Record) error
+	// Delete removes the processing state of the data object with given key
+	Delete(ctx context.Context, key string) error
+	// Orphans returns the objects holding states of data objects missing
+	// from the loaded listing, for stores holding states in objects
+	Orphans(ctx context.Context) ([]store.Object, error)
+	// Close releases the store resources
+	Close() error
+}
+
+// Current returns whether given record is the one of the current version
+// of given data object, so that objects overwritten after their processing
+// are processed again.
+// ETags are compared if both are known, last modification times otherwise.
+// Records lacking both (e.g. legacy markers) are considered current.
+func Current(rec *Record, o store.Object) bool {
+	if rec.ETag != "" && o.ETag != "" {
+		return rec.ETag == o.ETag
+	}
+	if !rec.LastModified.IsZero() && !o.LastModified.IsZero() {
+		return !o.LastModified.After(rec.LastModified)
+	}
+	return true
+}
+
+// processed is the Processed implementation for stores holding whole
+// records
+func processed(ctx context.Context, s Store, o store.Object) (bool, error) {
+	rec, err := s.Record(ctx, o)
+	if err != nil || rec == nil {
+		return false, err
+	}
+	return !rec.Partial && Current(rec, o), nil
+}
+
+// KeyStem returns given data object key without its suffix, taking
+// compression extensions into account so that "foo.csv.gz" matches the
+// ".csv" suffix as well as the ".csv.gz" one.
+// The boolean is false if the key does not match the suffix.
+func KeyStem(key, suffix string) (string, bool) {
+	if strings.HasSuffix(key, suffix) {
+		return strings.TrimSuffix(key, suffix), true
+	}
+	if k := compress.TrimExt(key); k != key && strings.HasSuffix(k, suffix) {
+		return strings.TrimSuffix(k, suffix), true
+	}
+	return "", false
+}
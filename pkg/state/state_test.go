@@ -0,0 +1,103 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+)
+
+func TestKeyStem(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		suffix string
+		want   string
+		wantOk bool
+	}{
+		{
+			name:   "Suffix should be trimmed",
+			key:    "foo/bar.csv",
+			suffix: ".csv",
+			want:   "foo/bar",
+			wantOk: true,
+		},
+		{
+			name:   "Compression extension should be trimmed along with suffix",
+			key:    "foo/bar.csv.gz",
+			suffix: ".csv",
+			want:   "foo/bar",
+			wantOk: true,
+		},
+		{
+			name:   "Suffix can include compression extension",
+			key:    "foo/bar.csv.zst",
+			suffix: ".csv.zst",
+			want:   "foo/bar",
+			wantOk: true,
+		},
+		{
+			name:   "Unmatched suffix should not match",
+			key:    "foo/bar.json",
+			suffix: ".csv",
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := KeyStem(tt.key, tt.suffix)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("KeyStem() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	t1 := time.Date(2021, 6, 24, 6, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	tests := []struct {
+		name string
+		rec  *Record
+		o    store.Object
+		want bool
+	}{
+		{
+			name: "Same ETag should be current",
+			rec:  &Record{ETag: "foo", LastModified: t1},
+			o:    store.Object{ETag: "foo", LastModified: t2},
+			want: true,
+		},
+		{
+			name: "Different ETag should not be current",
+			rec:  &Record{ETag: "foo", LastModified: t1},
+			o:    store.Object{ETag: "bar", LastModified: t1},
+			want: false,
+		},
+		{
+			name: "Unknown ETag and same last modification should be current",
+			rec:  &Record{LastModified: t1},
+			o:    store.Object{LastModified: t1},
+			want: true,
+		},
+		{
+			name: "Unknown ETag and later modification should not be current",
+			rec:  &Record{LastModified: t1},
+			o:    store.Object{LastModified: t2},
+			want: false,
+		},
+		{
+			name: "Legacy record should be current",
+			rec:  &Record{},
+			o:    store.Object{ETag: "foo", LastModified: t2},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Current(tt.rec, tt.o); got != tt.want {
+				t.Errorf("Current() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+)
+
+// ProcessedTagKey is the S3 object tag key marking data objects as processed
+const ProcessedTagKey = "influxdb-athena-crawler:processed"
+
+// PartialTagKey is the S3 object tag key holding the InfluxDB servers
+// partially processed data objects were written to
+const PartialTagKey = "influxdb-athena-crawler:partial"
+
+// tagValueRegexp matches valid S3 tag values
+var tagValueRegexp = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]{0,256}$`)
+
+// ServersTagValue returns the tag value holding given InfluxDB servers
+// addresses, the boolean is false if they do not fit an S3 tag value
+// (256 letters, digits, spaces and _ . : / = + - @ characters)
+func ServersTagValue(servers []string) (string, bool) {
+	v := strings.Join(servers, " ")
+	return v, tagValueRegexp.MatchString(v)
+}
+
+// TaggingClient is the subset of the S3 API used to tag objects,
+// it is implemented by *s3.Client
+type TaggingClient interface {
+	GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+	PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error)
+}
+
+// tagging is the Store implementation relying on S3 tags set on data
+// objects themselves
+type tagging struct {
+	cli    TaggingClient
+	bucket string
+}
+
+// NewTagging returns a Store implementation relying on S3 object tagging
+func NewTagging(cli TaggingClient, bucket string) Store {
+	return &tagging{
+		cli:    cli,
+		bucket: bucket,
+	}
+}
+
+// tags returns the tags of the object with given key
+func (t *tagging) tags(ctx context.Context, key string) ([]types.Tag, error) {
+	out, err := t.cli.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(t.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.TagSet, nil
+}
+
+// Load is the Store Load implementation for tagging, states are held by
+// data objects tags which are not listed
+func (t *tagging) Load(_ context.Context, _ []store.Object) error {
+	return nil
+}
+
+// Processed is the Store Processed implementation for tagging.
+// Overwriting an object replaces its tags, so that tagged objects are
+// always processed in their current version.
+func (t *tagging) Processed(ctx context.Context, o store.Object) (bool, error) {
+	tags, err := t.tags(ctx, o.Key)
+	if err != nil {
+		return false, err
+	}
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == ProcessedTagKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Record is the Store Record implementation for tagging, tags being too
+// small to hold a whole record only its processing time is returned, or
+// the servers written to for partial records
+func (t *tagging) Record(ctx context.Context, o store.Object) (*Record, error) {
+	tags, err := t.tags(ctx, o.Key)
+	if err != nil {
+		return nil, err
+	}
+	var rec *Record
+	for _, tag := range tags {
+		switch aws.ToString(tag.Key) {
+		case ProcessedTagKey:
+			at, _ := time.Parse(time.RFC3339, aws.ToString(tag.Value))
+			return &Record{ProcessedAt: at}, nil
+		case PartialTagKey:
+			rec = &Record{InfluxServers: strings.Fields(aws.ToString(tag.Value)), Partial: true}
+		}
+	}
+	return rec, nil
+}
+
+// MarkProcessed is the Store MarkProcessed implementation for tagging.
+// Existing tags are kept, the tag set being replaced as a whole.
+// Partial records only hold the servers written to, in a distinct tag.
+func (t *tagging) MarkProcessed(ctx context.Context, o store.Object, rec *Record) error {
+	tag := types.Tag{
+		Key:   aws.String(ProcessedTagKey),
+		Value: aws.String(rec.ProcessedAt.UTC().Format(time.RFC3339)),
+	}
+	if rec.Partial {
+		v, ok := ServersTagValue(rec.InfluxServers)
+		if !ok {
+			return fmt.Errorf("InfluxDB servers %q cannot be held by a tag", v)
+		}
+		tag = types.Tag{Key: aws.String(PartialTagKey), Value: aws.String(v)}
+	}
+
+	tags, err := t.tags(ctx, o.Key)
+	if err != nil {
+		return err
+	}
+
+	tagSet := make([]types.Tag, 0, len(tags)+1)
+	for _, tag := range tags {
+		if k := aws.ToString(tag.Key); k != ProcessedTagKey && k != PartialTagKey {
+			tagSet = append(tagSet, tag)
+		}
+	}
+	tagSet = append(tagSet, tag)
+
+	_, err = t.cli.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(t.bucket),
+		Key:     aws.String(o.Key),
+		Tagging: &types.Tagging{TagSet: tagSet},
+	})
+	return err
+}
+
+// Delete is the Store Delete implementation for tagging, states being
+// deleted along with data objects
+func (t *tagging) Delete(_ context.Context, _ string) error {
+	return nil
+}
+
+// Orphans is the Store Orphans implementation for tagging, states cannot
+// outlive their data object
+func (t *tagging) Orphans(_ context.Context) ([]store.Object, error) {
+	return nil, nil
+}
+
+// Close is the Store Close implementation for tagging
+func (t *tagging) Close() error {
+	return nil
+}
@@ -0,0 +1,150 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/quortex/influxdb-athena-crawler/pkg/store"
+)
+
+// fakeTaggingClient is an in memory TaggingClient implementation
+type fakeTaggingClient struct {
+	mu   sync.Mutex
+	tags map[string][]types.Tag
+}
+
+func (c *fakeTaggingClient) GetObjectTagging(_ context.Context, params *s3.GetObjectTaggingInput, _ ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tags, ok := c.tags[aws.ToString(params.Key)]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+	return &s3.GetObjectTaggingOutput{TagSet: tags}, nil
+}
+
+func (c *fakeTaggingClient) PutObjectTagging(_ context.Context, params *s3.PutObjectTaggingInput, _ ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tags[aws.ToString(params.Key)] = params.Tagging.TagSet
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
+func Test_tagging(t *testing.T) {
+	ctx := context.Background()
+	cli := &fakeTaggingClient{tags: map[string][]types.Tag{
+		"foo/bar.csv": {{Key: aws.String("team"), Value: aws.String("video")}},
+	}}
+	s := NewTagging(cli, "bucket")
+	o := store.Object{Key: "foo/bar.csv"}
+	rec := &Record{Rows: 1, Points: 1, ProcessedAt: time.Date(2021, 6, 24, 6, 0, 0, 0, time.UTC)}
+
+	if ok, err := s.Processed(ctx, o); err != nil || ok {
+		t.Errorf("tagging.Processed() = %v, %v, want false, nil", ok, err)
+	}
+	if err := s.MarkProcessed(ctx, o, rec); err != nil {
+		t.Fatalf("tagging.MarkProcessed() error = %v", err)
+	}
+	if ok, err := s.Processed(ctx, o); err != nil || !ok {
+		t.Errorf("tagging.Processed() = %v, %v, want true, nil", ok, err)
+	}
+	if got, err := s.Record(ctx, o); err != nil || got == nil || !got.ProcessedAt.Equal(rec.ProcessedAt) {
+		t.Errorf("tagging.Record() = %+v, %v, want processed at %v", got, err, rec.ProcessedAt)
+	}
+
+	// Marking twice should neither duplicate the tag nor drop existing ones
+	if err := s.MarkProcessed(ctx, o, rec); err != nil {
+		t.Fatalf("tagging.MarkProcessed() error = %v", err)
+	}
+	tags := cli.tags[o.Key]
+	if len(tags) != 2 || aws.ToString(tags[0].Key) != "team" || aws.ToString(tags[1].Key) != ProcessedTagKey {
+		t.Errorf("tagging.MarkProcessed() tags = %v", tags)
+	}
+
+	if _, err := s.Processed(ctx, store.Object{Key: "missing.csv"}); err == nil {
+		t.Errorf("tagging.Processed() on missing object should return an error")
+	}
+}
+
+func Test_tagging_partial(t *testing.T) {
+	ctx := context.Background()
+	cli := &fakeTaggingClient{tags: map[string][]types.Tag{
+		"foo/bar.csv": {{Key: aws.String("team"), Value: aws.String("video")}},
+	}}
+	s := NewTagging(cli, "bucket")
+	o := store.Object{Key: "foo/bar.csv"}
+
+	partial := &Record{InfluxServers: []string{"http://influxdb-0:8086", "http://influxdb-1:8086"}, Partial: true}
+	if err := s.MarkProcessed(ctx, o, partial); err != nil {
+		t.Fatalf("tagging.MarkProcessed() error = %v", err)
+	}
+	if ok, err := s.Processed(ctx, o); err != nil || ok {
+		t.Errorf("tagging.Processed() with partial record = %v, %v, want false, nil", ok, err)
+	}
+	if got, err := s.Record(ctx, o); err != nil || !reflect.DeepEqual(got, partial) {
+		t.Errorf("tagging.Record() = %+v, %v, want %+v, nil", got, err, partial)
+	}
+
+	// The complete record replaces the partial one
+	rec := &Record{ProcessedAt: time.Date(2021, 6, 24, 6, 0, 0, 0, time.UTC)}
+	if err := s.MarkProcessed(ctx, o, rec); err != nil {
+		t.Fatalf("tagging.MarkProcessed() error = %v", err)
+	}
+	if ok, err := s.Processed(ctx, o); err != nil || !ok {
+		t.Errorf("tagging.Processed() with complete record = %v, %v, want true, nil", ok, err)
+	}
+	tags := cli.tags[o.Key]
+	if len(tags) != 2 || aws.ToString(tags[0].Key) != "team" || aws.ToString(tags[1].Key) != ProcessedTagKey {
+		t.Errorf("tagging.MarkProcessed() tags = %v", tags)
+	}
+
+	// Servers which cannot be held by a tag should fail
+	invalid := &Record{InfluxServers: []string{"http://influxdb:8086/?org=foo&bucket=bar"}, Partial: true}
+	if err := s.MarkProcessed(ctx, o, invalid); err == nil {
+		t.Errorf("tagging.MarkProcessed() with invalid servers error = nil, want an error")
+	}
+}
+
+func Test_ServersTagValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers []string
+		want    string
+		wantOk  bool
+	}{
+		{
+			name:    "Servers should be separated by spaces",
+			servers: []string{"http://influxdb-0:8086", "https://influxdb-1.example.com"},
+			want:    "http://influxdb-0:8086 https://influxdb-1.example.com",
+			wantOk:  true,
+		},
+		{
+			name:    "Query strings should not fit a tag value",
+			servers: []string{"http://influxdb:8086/?org=foo"},
+			want:    "http://influxdb:8086/?org=foo",
+			wantOk:  false,
+		},
+		{
+			name:    "Too many servers should not fit a tag value",
+			servers: []string{strings.Repeat("a", 200), strings.Repeat("b", 200)},
+			want:    strings.Repeat("a", 200) + " " + strings.Repeat("b", 200),
+			wantOk:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ServersTagValue(tt.servers)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("ServersTagValue() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// maxLimitedRead is the maximum size of a single read accounted for by the
+// bandwidth limiter, so that reads are spread evenly over time
+const maxLimitedRead = 32 * 1024
+
+// DownloadOptions describes how S3 objects are downloaded
+type DownloadOptions struct {
+	// PartSize is the size of the ranges objects are downloaded by,
+	// objects no larger than it are downloaded with a single request
+	PartSize int64
+	// Concurrency is how many parts of an object are downloaded at once,
+	// objects are downloaded with a single request if lower than 2
+	Concurrency int
+	// MaxConnections limits the download requests in flight across all
+	// objects, unlimited if 0
+	MaxConnections int
+	// MaxBandwidth limits the download rate across all objects in bytes
+	// per second, unlimited if 0
+	MaxBandwidth int64
+}
+
+// Downloader downloads S3 objects within a budget of connections and
+// bandwidth shared by all stores using it
+type Downloader struct {
+	opts  DownloadOptions
+	conns chan struct{}
+	bw    *limiter
+}
+
+// NewDownloader returns a Downloader with given options
+func NewDownloader(opts DownloadOptions) *Downloader {
+	d := &Downloader{opts: opts}
+	if opts.MaxConnections > 0 {
+		d.conns = make(chan struct{}, opts.MaxConnections)
+	}
+	if opts.MaxBandwidth > 0 {
+		d.bw = &limiter{rate: opts.MaxBandwidth}
+	}
+	return d
+}
+
+// ranged returns whether objects are downloaded by ranges
+func (d *Downloader) ranged() bool {
+	return d.opts.PartSize > 0 && d.opts.Concurrency > 1
+}
+
+// acquire waits for a connection of the budget to be available, the
+// returned function releases it
+func (d *Downloader) acquire(ctx context.Context) (func(), error) {
+	if d.conns == nil {
+		return func() {}, nil
+	}
+	select {
+	case d.conns <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-d.conns }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// limit returns a reader reading from given one within the bandwidth budget
+func (d *Downloader) limit(ctx context.Context, r io.Reader) io.Reader {
+	if d.bw == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, r: r, l: d.bw}
+}
+
+// get returns a reader on the content of the object with given key.
+// Objects larger than the part size are downloaded by parts, up to the
+// concurrency ahead of the returned reader, other objects are streamed.
+func (d *Downloader) get(ctx context.Context, cli *s3.Client, bucket, key string) (*Reader, error) {
+	release, err := d.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if d.ranged() {
+		in.Range = aws.String(byteRange(0, d.opts.PartSize))
+	}
+	out, err := cli.GetObject(ctx, in)
+	var apiErr smithy.APIError
+	if in.Range != nil && errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRange" {
+		// Empty objects cannot be downloaded by range
+		in.Range = nil
+		out, err = cli.GetObject(ctx, in)
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	size := totalSize(aws.ToString(out.ContentRange))
+	if in.Range == nil || size <= d.opts.PartSize {
+		return &Reader{
+			ReadCloser: &streamReader{
+				Reader:  d.limit(ctx, out.Body),
+				body:    out.Body,
+				release: release,
+			},
+			ContentEncoding: aws.ToString(out.ContentEncoding),
+		}, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r := &partsReader{
+		ctx:    ctx,
+		cancel: cancel,
+		parts:  make(chan *part, d.opts.Concurrency-1),
+	}
+	go func() {
+		defer close(r.parts)
+
+		// The first part is the body of the first request
+		p := &part{done: make(chan struct{})}
+		r.parts <- p
+		go func() {
+			defer release()
+			defer out.Body.Close()
+			p.fill(d.readAll(ctx, out.Body, d.opts.PartSize))
+		}()
+
+		// Next parts are downloaded ahead of the reader, the object
+		// must not change meanwhile
+		for start := d.opts.PartSize; start < size; start += d.opts.PartSize {
+			p := &part{done: make(chan struct{})}
+			select {
+			case r.parts <- p:
+			case <-ctx.Done():
+				return
+			}
+			go func(start int64) {
+				p.fill(d.getPart(ctx, cli, in, aws.ToString(out.ETag), start, min(d.opts.PartSize, size-start)))
+			}(start)
+		}
+	}()
+	return &Reader{
+		ReadCloser:      r,
+		ContentEncoding: aws.ToString(out.ContentEncoding),
+	}, nil
+}
+
+// getPart downloads the part of given size starting at given offset of
+// the object of given input, whose ETag must match
+func (d *Downloader) getPart(ctx context.Context, cli *s3.Client, in *s3.GetObjectInput, etag string, start, size int64) ([]byte, error) {
+	release, err := d.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	out, err := cli.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:  in.Bucket,
+		Key:     in.Key,
+		Range:   aws.String(byteRange(start, size)),
+		IfMatch: aws.String(etag),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return d.readAll(ctx, out.Body, size)
+}
+
+// readAll reads given reader within the bandwidth budget, size being
+// the expected content size
+func (d *Downloader) readAll(ctx context.Context, r io.Reader, size int64) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	_, err := buf.ReadFrom(d.limit(ctx, r))
+	return buf.Bytes(), err
+}
+
+// byteRange returns the HTTP range of given size starting at given offset
+func byteRange(start, size int64) string {
+	return fmt.Sprintf("bytes=%d-%d", start, start+size-1)
+}
+
+// totalSize returns the object size of given Content-Range header value
+// (e.g. bytes 0-99/1000), -1 if unknown
+func totalSize(contentRange string) int64 {
+	_, total, ok := strings.Cut(contentRange, "/")
+	if !ok {
+		return -1
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// streamReader streams an object body, releasing its connection once closed
+type streamReader struct {
+	io.Reader
+	body    io.Closer
+	release func()
+}
+
+// Close closes the body and releases its connection
+func (s *streamReader) Close() error {
+	defer s.release()
+	return s.body.Close()
+}
+
+// part is the content of an object part, available once done is closed
+type part struct {
+	done chan struct{}
+	b    []byte
+	err  error
+}
+
+// fill sets the part content
+func (p *part) fill(b []byte, err error) {
+	p.b, p.err = b, err
+	close(p.done)
+}
+
+// partsReader reads the parts of an object in order
+type partsReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	parts  chan *part
+	cur    *bytes.Reader
+}
+
+// Read is the io.Reader Read implementation for partsReader
+func (r *partsReader) Read(b []byte) (int, error) {
+	for r.cur == nil || r.cur.Len() == 0 {
+		p, ok := <-r.parts
+		if !ok {
+			if err := r.ctx.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		<-p.done
+		if p.err != nil {
+			return 0, p.err
+		}
+		r.cur = bytes.NewReader(p.b)
+	}
+	return r.cur.Read(b)
+}
+
+// Close stops downloading parts
+func (r *partsReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// limiter limits a rate of bytes per second shared between readers
+type limiter struct {
+	mu   sync.Mutex
+	rate int64
+	next time.Time
+}
+
+// wait accounts for n bytes read, blocking until the reads accounted for
+// before are within the rate
+func (l *limiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	l.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limitedReader is a reader whose reads are limited by a limiter
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *limiter
+}
+
+// Read is the io.Reader Read implementation for limitedReader
+func (r *limitedReader) Read(b []byte) (int, error) {
+	if len(b) > maxLimitedRead {
+		b = b[:maxLimitedRead]
+	}
+	n, err := r.r.Read(b)
+	if n > 0 {
+		if wErr := r.l.wait(r.ctx, n); wErr != nil {
+			return n, wErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// fakeS3 serves a single object, supporting ranges and If-Match
+// conditions as S3 does
+type fakeS3 struct {
+	content  []byte
+	etag     string
+	delay    time.Duration
+	requests atomic.Int32
+	inFlight atomic.Int32
+	maxMu    sync.Mutex
+	max      int32
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests.Add(1)
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	f.maxMu.Lock()
+	f.max = max(f.max, n)
+	f.maxMu.Unlock()
+	time.Sleep(f.delay)
+
+	if m := r.Header.Get("If-Match"); m != "" && m != `"`+f.etag+`"` {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		_, _ = w.Write([]byte(`<Error><Code>PreconditionFailed</Code></Error>`))
+		return
+	}
+	w.Header().Set("ETag", `"`+f.etag+`"`)
+	rng := r.Header.Get("Range")
+	if rng == "" {
+		_, _ = w.Write(f.content)
+		return
+	}
+	var start, end int
+	if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil || start >= len(f.content) {
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		_, _ = w.Write([]byte(`<Error><Code>InvalidRange</Code></Error>`))
+		return
+	}
+	end = min(end, len(f.content)-1)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(f.content)))
+	w.WriteHeader(http.StatusPartialContent)
+	_, _ = w.Write(f.content[start : end+1])
+}
+
+// newFakeS3Store returns an S3 store on given fake S3 with given
+// download options
+func newFakeS3Store(t *testing.T, f *fakeS3, opts DownloadOptions) ObjectStore {
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	cli, err := NewS3Client(aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	}, S3Options{EndpointURL: srv.URL, UsePathStyle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewS3WithDownloader(cli, "bucket", NewDownloader(opts))
+}
+
+func TestDownloader_get(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		opts         DownloadOptions
+		wantRequests int32
+	}{
+		{
+			name:         "no ranges should download with a single request",
+			content:      "0123456789",
+			opts:         DownloadOptions{PartSize: 3, Concurrency: 1},
+			wantRequests: 1,
+		},
+		{
+			name:         "small object should download with a single request",
+			content:      "0123456789",
+			opts:         DownloadOptions{PartSize: 10, Concurrency: 4},
+			wantRequests: 1,
+		},
+		{
+			name:         "empty object should download without range",
+			content:      "",
+			opts:         DownloadOptions{PartSize: 10, Concurrency: 4},
+			wantRequests: 2,
+		},
+		{
+			name:         "large object should download by parts",
+			content:      "0123456789",
+			opts:         DownloadOptions{PartSize: 3, Concurrency: 2},
+			wantRequests: 4,
+		},
+		{
+			name:         "large object should download by parts within the connections budget",
+			content:      strings.Repeat("0123456789", 10),
+			opts:         DownloadOptions{PartSize: 7, Concurrency: 8, MaxConnections: 3},
+			wantRequests: 15,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeS3{content: []byte(tt.content), etag: "abc", delay: time.Millisecond}
+			s := newFakeS3Store(t, f, tt.opts)
+
+			r, err := s.Get(context.Background(), "a.csv")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			got, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if string(got) != tt.content {
+				t.Errorf("Get() content = %q, want %q", got, tt.content)
+			}
+			if n := f.requests.Load(); n != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", n, tt.wantRequests)
+			}
+			if tt.opts.MaxConnections > 0 && f.max > int32(tt.opts.MaxConnections) {
+				t.Errorf("max requests in flight = %d, want at most %d", f.max, tt.opts.MaxConnections)
+			}
+		})
+	}
+}
+
+func TestDownloader_get_changed(t *testing.T) {
+	f := &fakeS3{content: []byte("0123456789"), etag: "abc"}
+	s := newFakeS3Store(t, f, DownloadOptions{PartSize: 3, Concurrency: 2})
+
+	r, err := s.Get(context.Background(), "a.csv")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer r.Close()
+	// The object is overwritten while downloading parts
+	f.etag = "def"
+	if _, err := io.ReadAll(r); err == nil {
+		t.Errorf("ReadAll() error = nil, want an error")
+	}
+}
+
+func Test_limitedReader(t *testing.T) {
+	l := &limiter{rate: 10000}
+	content := bytes.Repeat([]byte("0"), 3000)
+	r := &limitedReader{ctx: context.Background(), r: bytes.NewReader(content), l: l}
+
+	start := time.Now()
+	buf := make([]byte, 1000)
+	var n int
+	for {
+		m, err := r.Read(buf)
+		n += m
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+	}
+	if n != len(content) {
+		t.Errorf("Read() = %d bytes, want %d", n, len(content))
+	}
+	// 1000 bytes are read at once, the 2 last reads wait for the
+	// previous ones at 10000 bytes per second
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Read() took %v, want at least 200ms", elapsed)
+	}
+}
+
+func Test_totalSize(t *testing.T) {
+	tests := []struct {
+		contentRange string
+		want         int64
+	}{
+		{contentRange: "bytes 0-99/1000", want: 1000},
+		{contentRange: "bytes 0-99/*", want: -1},
+		{contentRange: "", want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentRange, func(t *testing.T) {
+			if got := totalSize(tt.contentRange); got != tt.want {
+				t.Errorf("totalSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
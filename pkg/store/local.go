@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// localStore is the ObjectStore implementation for a local directory.
+// Object keys are slash separated paths relative to the root directory.
+type localStore struct {
+	root string
+}
+
+// NewLocal returns an ObjectStore implementation working on given directory
+func NewLocal(root string) ObjectStore {
+	return &localStore{root: root}
+}
+
+// path returns the filesystem path of the object with given key
+func (s *localStore) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+// List is the ObjectStore List implementation for a local directory
+func (s *localStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	res := []Object{}
+	err := filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		res = append(res, Object{
+			Key:          key,
+			LastModified: info.ModTime(),
+			Size:         info.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Mimic S3 which returns keys in lexicographical order
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res, nil
+}
+
+// Get is the ObjectStore Get implementation for a local directory
+func (s *localStore) Get(_ context.Context, key string) (*Reader, error) {
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{ReadCloser: f}, nil
+}
+
+// Put is the ObjectStore Put implementation for a local directory
+func (s *localStore) Put(_ context.Context, key string, body io.Reader) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Delete is the ObjectStore Delete implementation for a local directory
+func (s *localStore) Delete(_ context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
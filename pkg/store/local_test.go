@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_localStore_List(t *testing.T) {
+	root := t.TempDir()
+	for _, k := range []string{"foo/a.csv", "foo/a.processed", "foo/bar/b.csv", "baz/c.csv"} {
+		path := filepath.Join(root, filepath.FromSlash(k))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(k), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+		want   []string
+	}{
+		{
+			name:   "Empty prefix should list all objects",
+			prefix: "",
+			want:   []string{"baz/c.csv", "foo/a.csv", "foo/a.processed", "foo/bar/b.csv"},
+		},
+		{
+			name:   "Prefix should restrict listed objects",
+			prefix: "foo/",
+			want:   []string{"foo/a.csv", "foo/a.processed", "foo/bar/b.csv"},
+		},
+		{
+			name:   "Prefix can be a partial filename",
+			prefix: "foo/a",
+			want:   []string{"foo/a.csv", "foo/a.processed"},
+		},
+		{
+			name:   "Unmatched prefix should list nothing",
+			prefix: "qux",
+			want:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewLocal(root)
+			got, err := s.List(context.Background(), tt.prefix)
+			if err != nil {
+				t.Fatalf("localStore.List() error = %v", err)
+			}
+			keys := []string{}
+			for _, o := range got {
+				keys = append(keys, o.Key)
+				if o.Size != int64(len(o.Key)) {
+					t.Errorf("localStore.List() size = %d, want %d", o.Size, len(o.Key))
+				}
+			}
+			if !reflect.DeepEqual(keys, tt.want) {
+				t.Errorf("localStore.List() = %v, want %v", keys, tt.want)
+			}
+		})
+	}
+}
+
+func Test_localStore_PutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	s := NewLocal(t.TempDir())
+
+	if err := s.Put(ctx, "foo/bar.processed", strings.NewReader("baz")); err != nil {
+		t.Fatalf("localStore.Put() error = %v", err)
+	}
+
+	r, err := s.Get(ctx, "foo/bar.processed")
+	if err != nil {
+		t.Fatalf("localStore.Get() error = %v", err)
+	}
+	b, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("localStore.Get() read error = %v", err)
+	}
+	if string(b) != "baz" {
+		t.Errorf("localStore.Get() = %q, want %q", b, "baz")
+	}
+
+	if err := s.Delete(ctx, "foo/bar.processed"); err != nil {
+		t.Fatalf("localStore.Delete() error = %v", err)
+	}
+	if _, err := s.Get(ctx, "foo/bar.processed"); err == nil {
+		t.Errorf("localStore.Get() on deleted object should return an error")
+	}
+	if err := s.Delete(ctx, "foo/bar.processed"); err != nil {
+		t.Errorf("localStore.Delete() on missing object error = %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// S3Options describes S3 client options, mostly meant for S3 compatible
+// services (e.g. MinIO, Ceph RGW)
+type S3Options struct {
+	// EndpointURL is a custom endpoint URL, AWS S3 is used if empty
+	EndpointURL string
+	// UsePathStyle addresses buckets in the URL path rather than as
+	// a virtual host
+	UsePathStyle bool
+	// DisableSSL uses HTTP rather than HTTPS for resolved endpoints
+	DisableSSL bool
+	// RequesterPays acknowledges that requests to requester pays buckets
+	// are charged to the requester
+	RequesterPays bool
+	// CABundle is a PEM file of certificate authorities trusted in
+	// addition to the system ones
+	CABundle string
+}
+
+// NewS3Client returns an S3 client from given AWS config and options,
+// they apply to every request including uploads
+func NewS3Client(cfg aws.Config, opts S3Options) (*s3.Client, error) {
+	var httpClient *awshttp.BuildableClient
+	if opts.CABundle != "" {
+		pem, err := os.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA bundle %q", opts.CABundle)
+		}
+		httpClient = awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+			if tr.TLSClientConfig == nil {
+				tr.TLSClientConfig = &tls.Config{}
+			}
+			tr.TLSClientConfig.RootCAs = pool
+		})
+	}
+
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.EndpointURL != "" {
+			o.BaseEndpoint = aws.String(opts.EndpointURL)
+		}
+		o.UsePathStyle = opts.UsePathStyle
+		o.EndpointOptions.DisableHTTPS = opts.DisableSSL
+		if opts.RequesterPays {
+			o.APIOptions = append(o.APIOptions, smithyhttp.AddHeaderValue("x-amz-request-payer", "requester"))
+		}
+		if httpClient != nil {
+			o.HTTPClient = httpClient
+		}
+	}), nil
+}
+
+// s3Store is the ObjectStore implementation for AWS S3
+type s3Store struct {
+	cli    *s3.Client
+	upl    *manager.Uploader
+	dl     *Downloader
+	bucket string
+}
+
+// NewS3 returns an ObjectStore implementation working on given S3 bucket,
+// objects being downloaded with a single request each
+func NewS3(cli *s3.Client, bucket string) ObjectStore {
+	return NewS3WithDownloader(cli, bucket, NewDownloader(DownloadOptions{}))
+}
+
+// NewS3WithDownloader returns an ObjectStore implementation working on
+// given S3 bucket, objects being downloaded by given Downloader
+func NewS3WithDownloader(cli *s3.Client, bucket string, dl *Downloader) ObjectStore {
+	return &s3Store{
+		cli:    cli,
+		upl:    manager.NewUploader(cli),
+		dl:     dl,
+		bucket: bucket,
+	}
+}
+
+// List is the ObjectStore List implementation for S3
+func (s *s3Store) List(ctx context.Context, prefix string) ([]Object, error) {
+	res := []Object{}
+	p := s3.NewListObjectsV2Paginator(s.cli, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range page.Contents {
+			res = append(res, Object{
+				Key:          aws.ToString(o.Key),
+				LastModified: aws.ToTime(o.LastModified),
+				Size:         aws.ToInt64(o.Size),
+				ETag:         strings.Trim(aws.ToString(o.ETag), `"`),
+			})
+		}
+	}
+	return res, nil
+}
+
+// Get is the ObjectStore Get implementation for S3.
+// The returned reader streams the object body, or its parts for objects
+// downloaded by ranges, it is never fully held in memory.
+func (s *s3Store) Get(ctx context.Context, key string) (*Reader, error) {
+	return s.dl.get(ctx, s.cli, s.bucket, key)
+}
+
+// Put is the ObjectStore Put implementation for S3
+func (s *s3Store) Put(ctx context.Context, key string, body io.Reader) error {
+	return s.put(ctx, key, body, "")
+}
+
+// put uploads an object with given storage class, the bucket default
+// one if empty
+func (s *s3Store) put(ctx context.Context, key string, body io.Reader, storageClass string) error {
+	_, err := s.upl.Upload(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(key),
+		Body:         body,
+		StorageClass: types.StorageClass(storageClass),
+	})
+	return err
+}
+
+// copyFrom copies server side the object with given key of given bucket
+// with given storage class, the bucket default one if empty
+func (s *s3Store) copyFrom(ctx context.Context, bucket, key, dstKey, storageClass string) error {
+	_, err := s.cli.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(dstKey),
+		CopySource:   aws.String((&url.URL{Path: bucket + "/" + key}).EscapedPath()),
+		StorageClass: types.StorageClass(storageClass),
+	})
+	return err
+}
+
+// Delete is the ObjectStore Delete implementation for S3
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.cli.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+func TestNewS3Client(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      S3Options
+		tls       bool
+		wantPath  string
+		wantPayer string
+	}{
+		{
+			name:     "path style",
+			opts:     S3Options{UsePathStyle: true},
+			wantPath: "/bucket",
+		},
+		{
+			name:      "requester pays",
+			opts:      S3Options{UsePathStyle: true, RequesterPays: true},
+			wantPath:  "/bucket",
+			wantPayer: "requester",
+		},
+		{
+			name:     "custom CA bundle",
+			opts:     S3Options{UsePathStyle: true},
+			tls:      true,
+			wantPath: "/bucket",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotPayer string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath, gotPayer = r.URL.Path, r.Header.Get("x-amz-request-payer")
+				w.Header().Set("Content-Type", "application/xml")
+				_, _ = w.Write([]byte(`<ListBucketResult><IsTruncated>false</IsTruncated>` +
+					`<Contents><Key>a.csv</Key><ETag>"abc"</ETag><Size>3</Size></Contents></ListBucketResult>`))
+			})
+			var srv *httptest.Server
+			if tt.tls {
+				srv = httptest.NewTLSServer(handler)
+				tt.opts.CABundle = filepath.Join(t.TempDir(), "ca.pem")
+				b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+				if err := os.WriteFile(tt.opts.CABundle, b, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				srv = httptest.NewServer(handler)
+			}
+			defer srv.Close()
+
+			tt.opts.EndpointURL = srv.URL
+			cli, err := NewS3Client(aws.Config{
+				Region:      "us-east-1",
+				Credentials: credentials.NewStaticCredentialsProvider("key", "secret", ""),
+			}, tt.opts)
+			if err != nil {
+				t.Fatalf("NewS3Client() error = %v", err)
+			}
+			objs, err := NewS3(cli, "bucket").List(context.Background(), "")
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if len(objs) != 1 || objs[0].Key != "a.csv" || objs[0].ETag != "abc" {
+				t.Errorf("List() = %v", objs)
+			}
+			if gotPath != tt.wantPath {
+				t.Errorf("request path = %q, want %q", gotPath, tt.wantPath)
+			}
+			if gotPayer != tt.wantPayer {
+				t.Errorf("x-amz-request-payer = %q, want %q", gotPayer, tt.wantPayer)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Object describes an object held by an ObjectStore
+type Object struct {
+	Key          string
+	LastModified time.Time
+	Size         int64
+	// ETag identifies the object content, it is empty for stores
+	// that do not provide any
+	ETag string
+}
+
+// Reader is the content of an object returned by an ObjectStore
+type Reader struct {
+	io.ReadCloser
+	// ContentEncoding is the encoding declared along with the object, if any
+	ContentEncoding string
+}
+
+// Read is the io.Reader Read implementation for Reader, failures to read
+// the content being returned as *ReadError
+func (r *Reader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	var rErr *ReadError
+	if err != nil && err != io.EOF && !errors.As(err, &rErr) {
+		err = &ReadError{Err: err}
+	}
+	return n, err
+}
+
+// ReadError describes a failure to read the content of an object (e.g. a
+// connection reset), as opposed to an invalid content
+type ReadError struct {
+	Err error
+}
+
+// Error is the error implementation for ReadError
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("failed to read object: %v", e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// ObjectStore describes what an object store should do
+type ObjectStore interface {
+	// List returns all objects whose key starts with given prefix
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// Get returns a reader on the content of the object with given key
+	Get(ctx context.Context, key string) (*Reader, error)
+	// Put writes an object (typically a processed marker) with given key and content
+	Put(ctx context.Context, key string, body io.Reader) error
+	// Delete removes the object with given key, deleting a missing
+	// object is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// ParseS3URI returns the bucket and key of given s3://bucket/key URI
+func ParseS3URI(uri string) (bucket, key string, err error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("%q is not a valid s3://bucket/key URI", uri)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// Find returns the object with given key, the boolean is false if it
+// does not exist
+func Find(ctx context.Context, s ObjectStore, key string) (Object, bool, error) {
+	objs, err := s.List(ctx, key)
+	if err != nil {
+		return Object{}, false, err
+	}
+	for _, o := range objs {
+		if o.Key == key {
+			return o, true, nil
+		}
+	}
+	return Object{}, false, nil
+}
+
+// maxCopySize is the size of the largest object S3 can copy server side
+// with a single request
+const maxCopySize = 5 * 1024 * 1024 * 1024
+
+// Copy copies given object from src to dst with given destination key.
+// Copies between S3 stores sharing a client, thus credentials, are done
+// server side for objects up to 5 GiB, other copies stream the object
+// from src with its credentials to dst with its own.
+// The storage class, if any, only applies to S3 destinations.
+func Copy(ctx context.Context, src ObjectStore, o Object, dst ObjectStore, dstKey, storageClass string) error {
+	srcS3, srcOk := src.(*s3Store)
+	dstS3, dstOk := dst.(*s3Store)
+	if srcOk && dstOk && srcS3.cli == dstS3.cli && o.Size <= maxCopySize {
+		return dstS3.copyFrom(ctx, srcS3.bucket, o.Key, dstKey, storageClass)
+	}
+
+	r, err := src.Get(ctx, o.Key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if dstOk {
+		return dstS3.put(ctx, dstKey, r, storageClass)
+	}
+	return dst.Put(ctx, dstKey, r)
+}
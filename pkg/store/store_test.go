@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func Test_ParseS3URI(t *testing.T) {
+	tests := []struct {
+		name       string
+		uri        string
+		wantBucket string
+		wantKey    string
+		wantErr    bool
+	}{
+		{
+			name:       "Valid URI should be parsed",
+			uri:        "s3://foo/bar/baz.csv",
+			wantBucket: "foo",
+			wantKey:    "bar/baz.csv",
+			wantErr:    false,
+		},
+		{
+			name:       "Bucket only URI should return an empty key",
+			uri:        "s3://foo",
+			wantBucket: "foo",
+			wantKey:    "",
+			wantErr:    false,
+		},
+		{
+			name:    "Non s3 URI should return an error",
+			uri:     "https://foo/bar",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, key, err := ParseS3URI(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseS3URI() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if bucket != tt.wantBucket || key != tt.wantKey {
+				t.Errorf("ParseS3URI() = %q, %q, want %q, %q", bucket, key, tt.wantBucket, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	src := NewLocal(t.TempDir())
+	dst := NewLocal(t.TempDir())
+	if err := src.Put(ctx, "foo/bar.csv", strings.NewReader("baz")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Copy(ctx, src, Object{Key: "foo/bar.csv", Size: 3}, dst, "archive/foo/bar.csv", ""); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	r, err := dst.Get(ctx, "archive/foo/bar.csv")
+	if err != nil {
+		t.Fatalf("Copy() destination error = %v", err)
+	}
+	defer r.Close()
+	if b, _ := io.ReadAll(r); string(b) != "baz" {
+		t.Errorf("Copy() destination content = %q, want %q", b, "baz")
+	}
+
+	if err := Copy(ctx, src, Object{Key: "foo/missing.csv"}, dst, "archive/foo/missing.csv", ""); err == nil {
+		t.Errorf("Copy() of missing object should return an error")
+	}
+}
+
+// failingReader returns its content, then fails with its error
+type failingReader struct {
+	io.Reader
+	err error
+}
+
+func (f *failingReader) Read(b []byte) (int, error) {
+	n, err := f.Reader.Read(b)
+	if err == io.EOF {
+		err = f.err
+	}
+	return n, err
+}
+
+func TestReader_Read(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantReadError bool
+	}{
+		{
+			name:          "End of content should not be a read error",
+			err:           io.EOF,
+			wantReadError: false,
+		},
+		{
+			name:          "Failure should be a read error",
+			err:           io.ErrUnexpectedEOF,
+			wantReadError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reader{ReadCloser: io.NopCloser(&failingReader{Reader: strings.NewReader("foo"), err: tt.err})}
+			got, err := io.ReadAll(r)
+			if string(got) != "foo" {
+				t.Errorf("Read() content = %q, want %q", got, "foo")
+			}
+			var rErr *ReadError
+			if errors.As(err, &rErr) != tt.wantReadError {
+				t.Errorf("Read() error = %v, wantReadError %v", err, tt.wantReadError)
+			}
+			if tt.wantReadError && !errors.Is(err, tt.err) {
+				t.Errorf("Read() error = %v, want it to wrap %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCopy_s3(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		req := r.Method + " " + r.URL.Path
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			req += " copy"
+		}
+		requests = append(requests, req)
+		mu.Unlock()
+
+		switch {
+		case r.Header.Get("X-Amz-Copy-Source") != "":
+			_, _ = w.Write([]byte(`<CopyObjectResult><ETag>"abc"</ETag></CopyObjectResult>`))
+		case r.Method == http.MethodGet:
+			_, _ = w.Write([]byte("baz"))
+		default:
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.Header().Set("ETag", `"abc"`)
+		}
+	}))
+	defer srv.Close()
+
+	newClient := func() *s3.Client {
+		cli, err := NewS3Client(aws.Config{
+			Region:      "us-east-1",
+			Credentials: credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		}, S3Options{EndpointURL: srv.URL, UsePathStyle: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cli
+	}
+	cli := newClient()
+
+	tests := []struct {
+		name string
+		dst  ObjectStore
+		size int64
+		want []string
+	}{
+		{
+			name: "Copy with the same client should be done server side",
+			dst:  NewS3(cli, "archive"),
+			size: 3,
+			want: []string{"PUT /archive/foo/bar.csv copy"},
+		},
+		{
+			name: "Copy with another client should be streamed",
+			dst:  NewS3(newClient(), "archive"),
+			size: 3,
+			want: []string{"GET /bucket/foo/bar.csv", "PUT /archive/foo/bar.csv"},
+		},
+		{
+			name: "Copy of an object larger than 5 GiB should be streamed",
+			dst:  NewS3(cli, "archive"),
+			size: maxCopySize + 1,
+			want: []string{"GET /bucket/foo/bar.csv", "PUT /archive/foo/bar.csv"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = nil
+			err := Copy(context.Background(), NewS3(cli, "bucket"), Object{Key: "foo/bar.csv", Size: tt.size}, tt.dst, "foo/bar.csv", "")
+			if err != nil {
+				t.Fatalf("Copy() error = %v", err)
+			}
+			if !reflect.DeepEqual(requests, tt.want) {
+				t.Errorf("Copy() requests = %v, want %v", requests, tt.want)
+			}
+		})
+	}
+}